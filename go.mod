@@ -3,8 +3,11 @@ module github.com/Crocmagnon/downloader-go
 go 1.23.3
 
 require (
+	filippo.io/age v1.2.1
 	github.com/alecthomas/kong v1.6.0
 	github.com/playwright-community/playwright-go v0.4802.0
+	golang.org/x/term v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -12,6 +15,9 @@ require (
 	github.com/deckarep/golang-set/v2 v2.7.0 // indirect
 	github.com/go-jose/go-jose/v3 v3.0.3 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
+	github.com/kr/text v0.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
@@ -0,0 +1,40 @@
+// Package atomicfile writes files that are never left truncated, even when the process is killed mid-write.
+package atomicfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Write writes content to a temporary file next to path, flushes it to disk and renames it over path.
+// Concurrent writers each use their own temporary file, the last rename wins.
+// The file is readable by its owner only.
+func Write(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+
+	tmpPath := tmp.Name()
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+// Package config loads the downloader configuration file.
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/naming"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"github.com/Crocmagnon/downloader-go/internal/pw"
+	"github.com/Crocmagnon/downloader-go/internal/retention"
+	"github.com/Crocmagnon/downloader-go/internal/secrets"
+	"gopkg.in/yaml.v3"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown provider")
+	ErrUnknownKey       = errors.New("unknown key")
+	ErrMissingField     = errors.New("missing credential")
+	ErrUnknownAccount   = errors.New("unknown account")
+	ErrDuplicateAccount = errors.New("duplicate account")
+	ErrInvalidValue     = errors.New("invalid value")
+)
+
+// Config is the content of the configuration file.
+type Config struct {
+	OutputDir        string                    `yaml:"output_dir"`
+	SessionDir       string                    `yaml:"session_dir"`
+	SessionKey       SessionKey                `yaml:"session_key"`
+	Manifest         string                    `yaml:"manifest"`
+	Headless         bool                      `yaml:"headless"`
+	NoInteraction    bool                      `yaml:"no_interaction"`
+	Timeout          time.Duration             `yaml:"timeout"`
+	Browser          string                    `yaml:"browser"`
+	FilenameTemplate string                    `yaml:"filename_template"`
+	OnCollision      string                    `yaml:"on_collision"`
+	DriverDir        string                    `yaml:"driver_dir"`
+	QuarantineDir    string                    `yaml:"quarantine_dir"`
+	ArtifactsDir     string                    `yaml:"artifacts_dir"`
+	ArtifactsKeep    int                       `yaml:"artifacts_keep"`
+	Trace            bool                      `yaml:"trace"`
+	RecordHAR        bool                      `yaml:"record_har"`
+	RecordVideo      string                    `yaml:"record_video"`
+	VideoMaxSize     int64                     `yaml:"video_max_size"`
+	Layout           string                    `yaml:"layout"`
+	Retention        map[string]string         `yaml:"retention"`
+	Secrets          secrets.Settings          `yaml:"secrets"`
+	Providers        map[string]ProviderConfig `yaml:"providers"`
+	// NoInstall is ignored: runs never install the driver and browsers, the install command does.
+	// It is kept so that existing files stay valid.
+	NoInstall bool `yaml:"no_install"`
+}
+
+// SessionKey selects the key encrypting session files. Passphrase may be a secret reference, e.g. pass:downloader.
+type SessionKey struct {
+	Passphrase string `yaml:"passphrase"`
+	File       string `yaml:"file"`
+}
+
+// ProviderConfig holds the settings of a single provider.
+type ProviderConfig struct {
+	Browser          string            `yaml:"browser"`
+	FilenameTemplate string            `yaml:"filename_template"`
+	ExpectedPages    int               `yaml:"expected_pages"`
+	Accounts         []Account         `yaml:"accounts"`
+	Options          map[string]string `yaml:"options"`
+}
+
+// Account is a set of credentials for a provider. Credentials are keyed by provider.CredentialField name.
+type Account struct {
+	Name        string            `yaml:"name"`
+	Credentials map[string]string `yaml:",inline"`
+}
+
+// DefaultPath returns the default location of the configuration file.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "downloader", "config.yaml")
+}
+
+// Load reads the configuration file at path.
+// Unknown top-level and provider keys are reported as errors.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	return Parse(content)
+}
+
+// Parse parses the content of a configuration file.
+func Parse(content []byte) (*Config, error) {
+	var cfg Config
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks cfg against the providers of reg and returns every problem found.
+func (c *Config) Validate(reg *provider.Registry) []error {
+	var problems []error
+
+	if c.Browser != "" {
+		if _, err := pw.ParseBrowser(c.Browser); err != nil {
+			problems = append(problems, fmt.Errorf("browser: %w", err))
+		}
+	}
+
+	if c.FilenameTemplate != "" {
+		if _, err := naming.Parse(c.FilenameTemplate); err != nil {
+			problems = append(problems, fmt.Errorf("filename_template: %w", err))
+		}
+	}
+
+	if c.OnCollision != "" {
+		if _, err := pw.ParseCollision(c.OnCollision); err != nil {
+			problems = append(problems, fmt.Errorf("on_collision: %w", err))
+		}
+	}
+
+	if c.RecordVideo != "" {
+		if _, err := pw.ParseVideo(c.RecordVideo); err != nil {
+			problems = append(problems, fmt.Errorf("record_video: %w", err))
+		}
+	}
+
+	if c.Layout != "" {
+		if _, err := naming.ParseLayout(c.Layout); err != nil {
+			problems = append(problems, fmt.Errorf("layout: %w", err))
+		}
+	}
+
+	if _, err := retention.ParsePolicy(c.Retention); err != nil {
+		problems = append(problems, fmt.Errorf("retention: %w", err))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Providers)) {
+		prov, ok := reg.Get(name)
+		if !ok {
+			problems = append(problems, fmt.Errorf("providers: %w %q", ErrUnknownProvider, name))
+			continue
+		}
+
+		problems = append(problems, c.Providers[name].validate(prov)...)
+	}
+
+	return problems
+}
+
+func (p ProviderConfig) validate(prov provider.Provider) []error {
+	var problems []error
+
+	if p.Browser != "" {
+		if _, err := pw.ParseBrowser(p.Browser); err != nil {
+			problems = append(problems, fmt.Errorf("%s: browser: %w", prov.Name(), err))
+		}
+	}
+
+	if p.FilenameTemplate != "" {
+		if _, err := naming.Parse(p.FilenameTemplate); err != nil {
+			problems = append(problems, fmt.Errorf("%s: filename_template: %w", prov.Name(), err))
+		}
+	}
+
+	if p.ExpectedPages < 0 {
+		problems = append(problems, fmt.Errorf("%s: expected_pages: %w: %d", prov.Name(), ErrInvalidValue, p.ExpectedPages))
+	}
+
+	settings := provider.SettingsOf(prov)
+
+	for _, key := range slices.Sorted(maps.Keys(p.Options)) {
+		if !slices.ContainsFunc(settings, func(s provider.Setting) bool { return s.Name == key }) {
+			problems = append(problems, fmt.Errorf("%s: options: %w %q", prov.Name(), ErrUnknownKey, key))
+		}
+	}
+
+	fields := prov.CredentialFields()
+	seen := make(map[string]bool, len(p.Accounts))
+
+	for i, account := range p.Accounts {
+		label := fmt.Sprintf("%s: account %q", prov.Name(), account.Name)
+		if account.Name == "" {
+			label = fmt.Sprintf("%s: account #%d", prov.Name(), i+1)
+		}
+
+		if seen[account.Name] {
+			problems = append(problems, fmt.Errorf("%s: %w", label, ErrDuplicateAccount))
+		}
+
+		seen[account.Name] = true
+
+		for _, key := range slices.Sorted(maps.Keys(account.Credentials)) {
+			if !slices.ContainsFunc(fields, func(f provider.CredentialField) bool { return f.Name == key }) {
+				problems = append(problems, fmt.Errorf("%s: %w %q", label, ErrUnknownKey, key))
+			}
+		}
+
+		for _, missing := range provider.Credentials(account.Credentials).Missing(fields) {
+			problems = append(problems, fmt.Errorf("%s: %w %q", label, ErrMissingField, missing))
+		}
+	}
+
+	return problems
+}
+
+// Account returns the account named name of the provider named providerName.
+// An empty name selects the first account, or an empty account when the provider has none.
+func (c *Config) Account(providerName, name string) (Account, error) {
+	accounts := c.Providers[providerName].Accounts
+	if len(accounts) == 0 {
+		if name != "" {
+			return Account{}, fmt.Errorf("%w %q for %s", ErrUnknownAccount, name, providerName)
+		}
+
+		return Account{}, nil
+	}
+
+	if name == "" {
+		return accounts[0], nil
+	}
+
+	for _, account := range accounts {
+		if account.Name == name {
+			return account, nil
+		}
+	}
+
+	return Account{}, fmt.Errorf("%w %q for %s", ErrUnknownAccount, name, providerName)
+}
+
+// BrowserFor returns the browser to use for prov: the provider setting, then the global one,
+// then the provider preference.
+func (c *Config) BrowserFor(prov provider.Provider) (pw.Browser, error) {
+	name := c.Providers[prov.Name()].Browser
+	if name == "" {
+		name = c.Browser
+	}
+
+	if name == "" {
+		return prov.Browser(), nil
+	}
+
+	return pw.ParseBrowser(name)
+}
+
+// FilenameTemplateFor returns the template naming the documents of prov: the one set for prov, else the global one,
+// else the provider default.
+func (c *Config) FilenameTemplateFor(prov provider.Provider) (naming.Template, error) {
+	template := cmp.Or(c.Providers[prov.Name()].FilenameTemplate, c.FilenameTemplate)
+	if template == "" {
+		return provider.FilenameTemplate(prov), nil
+	}
+
+	return naming.Parse(template)
+}
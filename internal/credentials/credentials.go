@@ -0,0 +1,166 @@
+// Package credentials resolves provider credentials from several sources.
+package credentials
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrNoTerminal = errors.New("stdin is not a terminal")
+
+// Precedence documents the order in which sources are looked up.
+const Precedence = `Credentials are resolved in this order, the first source holding a value wins:
+command line flag, --<field>-file, --<field>-fd, DOWNLOADER_<PROVIDER>_<FIELD> environment variable,
+configuration file, then an interactive prompt (without echo for secrets) unless --no-interaction is set.
+Values of the configuration file may reference a secret: pass:<entry>, age:<file>[#<key.path>] or exec:<command>,
+prefix them with literal: to use them as is.`
+
+// Sources holds the places a credential value can come from, keyed by provider.CredentialField name.
+type Sources struct {
+	Flags  map[string]string
+	Files  map[string]string
+	FDs    map[string]int
+	Lookup func(string) (string, bool)
+	Config map[string]string
+	// Prompt asks the user for missing values. It is not used when nil.
+	Prompt Prompter
+	// Secrets resolves secret references in Config values. References are kept as is when nil.
+	Secrets SecretResolver
+}
+
+// SecretResolver resolves secret references such as pass:banks/lcl, see the secrets package.
+type SecretResolver interface {
+	Resolve(value string) (string, error)
+}
+
+// Prompter asks the user for a credential value.
+type Prompter interface {
+	Prompt(label string, secret bool) (string, error)
+}
+
+// Resolve returns the credentials of prov, looking up each field in src in order of Precedence.
+// Fields absent from every source are left empty.
+func Resolve(prov provider.Provider, src Sources) (provider.Credentials, error) {
+	creds := make(provider.Credentials, len(prov.CredentialFields()))
+
+	for _, field := range prov.CredentialFields() {
+		value, err := resolveField(prov, field, src)
+		if err == nil && value == "" && src.Prompt != nil {
+			value, err = src.Prompt.Prompt(field.Help, field.Secret)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", field.Name, err)
+		}
+
+		if value != "" {
+			creds[field.Name] = value
+		}
+	}
+
+	return creds, nil
+}
+
+// resolveField returns the value of field found in src, except for the prompt. Only values of the configuration
+// file may reference secrets: values of other sources are used as is, even if they look like a reference.
+func resolveField(prov provider.Provider, field provider.CredentialField, src Sources) (string, error) {
+	value, err := lookupField(prov, field, src)
+	if err != nil || value != "" {
+		return value, err
+	}
+
+	value = src.Config[field.Name]
+	if value == "" || src.Secrets == nil {
+		return value, nil
+	}
+
+	return src.Secrets.Resolve(value)
+}
+
+// lookupField returns the first value of field found in src, except for the configuration file and the prompt.
+func lookupField(prov provider.Provider, field provider.CredentialField, src Sources) (string, error) {
+	if value := src.Flags[field.Name]; value != "" {
+		return value, nil
+	}
+
+	if path := src.Files[field.Name]; path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		return trimNewline(string(content)), nil
+	}
+
+	if fd, ok := src.FDs[field.Name]; ok {
+		return readFD(fd)
+	}
+
+	if src.Lookup != nil {
+		if value, ok := src.Lookup(provider.EnvVar(prov.Name(), field.Name)); ok && value != "" {
+			return value, nil
+		}
+	}
+
+	return "", nil
+}
+
+func readFD(fd int) (string, error) {
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if file == nil {
+		return "", fmt.Errorf("invalid file descriptor %d", fd)
+	}
+
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("reading fd %d: %w", fd, err)
+	}
+
+	return trimNewline(string(content)), nil
+}
+
+func trimNewline(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
+
+// TerminalPrompter prompts on a terminal, hiding secret values.
+type TerminalPrompter struct {
+	In  *os.File
+	Out io.Writer
+}
+
+// Prompt implements Prompter.
+func (p TerminalPrompter) Prompt(label string, secret bool) (string, error) {
+	fd := int(p.In.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("prompting for %s: %w", label, ErrNoTerminal)
+	}
+
+	_, _ = fmt.Fprintf(p.Out, "%s: ", label)
+
+	if secret {
+		value, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(p.Out)
+
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", label, err)
+		}
+
+		return string(value), nil
+	}
+
+	value, err := bufio.NewReader(p.In).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", label, err)
+	}
+
+	return trimNewline(value), nil
+}
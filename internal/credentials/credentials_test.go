@@ -0,0 +1,78 @@
+package credentials
+
+import (
+	"context"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"github.com/Crocmagnon/downloader-go/internal/pw"
+	"testing"
+)
+
+type fakeProvider struct{}
+
+func (fakeProvider) Name() string                           { return "bank" }
+func (fakeProvider) Description() string                    { return "" }
+func (fakeProvider) DocumentTypes() []provider.DocumentType { return nil }
+func (fakeProvider) Browser() pw.Browser                    { return 0 }
+
+func (fakeProvider) CredentialFields() []provider.CredentialField {
+	return []provider.CredentialField{{Name: "password", Secret: true}}
+}
+
+func (fakeProvider) Run(context.Context, provider.Options) (provider.Result, error) {
+	return provider.Result{}, nil
+}
+
+// refuser fails the test when asked to resolve a reference.
+type refuser struct {
+	t *testing.T
+}
+
+func (r refuser) Resolve(value string) (string, error) {
+	r.t.Errorf("resolved %q", value)
+
+	return "", nil
+}
+
+// resolver resolves every value to a fixed secret.
+type resolver struct{}
+
+func (resolver) Resolve(string) (string, error) {
+	return "hunter2", nil
+}
+
+func TestResolveOnlyConfigReferences(t *testing.T) {
+	const value = "exec:touch /tmp/pwned"
+
+	sources := map[string]Sources{
+		"flag": {Flags: map[string]string{"password": value}},
+		"env": {Lookup: func(name string) (string, bool) {
+			return value, name == provider.EnvVar("bank", "password")
+		}},
+	}
+
+	for name, src := range sources {
+		src.Config = map[string]string{"password": "pass:banks/lcl"}
+		src.Secrets = refuser{t}
+
+		creds, err := Resolve(fakeProvider{}, src)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if creds["password"] != value {
+			t.Errorf("%s: got %q, want %q", name, creds["password"], value)
+		}
+	}
+
+	creds, err := Resolve(fakeProvider{}, Sources{
+		Config:  map[string]string{"password": "pass:banks/lcl"},
+		Secrets: resolver{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds["password"] != "hunter2" {
+		t.Errorf("config: got %q, want %q", creds["password"], "hunter2")
+	}
+}
@@ -1,26 +1,58 @@
 package eaudugrandlyon
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
 	"github.com/Crocmagnon/downloader-go/internal/pw"
 	"github.com/playwright-community/playwright-go"
-	"io"
+	"log/slog"
 )
 
 var errNotImplemented = errors.New("not implemented")
 
-func Run(stdout, stderr io.Writer, headless bool, username, password, dir string) error {
-	return pw.Run(stdout, stderr, headless, pw.BrowserFirefox, func(page playwright.Page) error {
-		return downloadFile(page, username, password, dir)
+// Provider implements provider.Provider for Eau du Grand Lyon.
+type Provider struct{}
+
+func (Provider) Name() string { return "eau-du-grand-lyon" }
+
+func (Provider) Description() string { return "Download latest invoice from Eau du Grand Lyon." }
+
+func (Provider) DocumentTypes() []provider.DocumentType {
+	return []provider.DocumentType{provider.DocumentInvoice}
+}
+
+func (Provider) Browser() pw.Browser { return pw.BrowserFirefox }
+
+func (Provider) CredentialFields() []provider.CredentialField {
+	return provider.UsernamePassword("Eau du Grand Lyon")
+}
+
+func (Provider) Run(ctx context.Context, opts provider.Options) (provider.Result, error) {
+	return provider.Run(ctx, opts, func(page playwright.Page, session *pw.Session, opts provider.Options) error {
+		return downloadFile(page, session, opts.Credentials.Username(), opts.Credentials.Password(), opts.OutputDir, opts.Log())
 	})
 }
 
-func downloadFile(page playwright.Page, identifier, password, outputDir string) error {
+func downloadFile(
+	page playwright.Page,
+	session *pw.Session,
+	identifier, password, outputDir string,
+	logger *slog.Logger,
+) error {
+	logger.Info("logging in")
+
 	if err := login(page, identifier, password); err != nil {
 		return fmt.Errorf("logging in: %w", err)
 	}
 
+	logger.Info("logged in")
+
+	if err := session.Save(); err != nil {
+		return err
+	}
+
 	if err := downloadAndSave(page, outputDir); err != nil {
 		return fmt.Errorf("downloading and saving: %w", err)
 	}
@@ -29,9 +61,9 @@ func downloadFile(page playwright.Page, identifier, password, outputDir string)
 }
 
 func login(page playwright.Page, identifier, password string) error {
-	_, err := page.Goto("https://agence.eaudugrandlyon.com/#/login")
+	err := pw.Goto(page, "https://agence.eaudugrandlyon.com/#/login")
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
 	err = page.WaitForURL("https://agence.eaudugrandlyon.com/#/tableau-de-bord", playwright.PageWaitForURLOptions{Timeout: playwright.Float(2000)})
@@ -55,8 +87,8 @@ func login(page playwright.Page, identifier, password string) error {
 }
 
 func downloadAndSave(page playwright.Page, outputDir string) error {
-	if _, err := page.Goto("https://agence.eaudugrandlyon.com/#/factures"); err != nil {
-		return fmt.Errorf("going to: %w", err)
+	if err := pw.Goto(page, "https://agence.eaudugrandlyon.com/#/factures"); err != nil {
+		return err
 	}
 
 	return fmt.Errorf("%w: no invoice available when developing", errNotImplemented)
@@ -0,0 +1,81 @@
+// Package errs defines the categories of provider failures and the exit code of each.
+//
+// Providers wrap their errors with one of the sentinel errors, e.g. fmt.Errorf("%w: %w", errs.ErrSiteChanged, err),
+// so that callers can tell transient failures, worth retrying, from those needing a human.
+package errs
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrBadCredentials is returned when the site rejects the credentials.
+	ErrBadCredentials = errors.New("bad credentials")
+	// ErrInteractionRequired is returned when the site asks for user input, e.g. an MFA code, in no-interaction mode.
+	ErrInteractionRequired = errors.New("interaction required")
+	// ErrMFAFailed is returned when a multi-factor authentication code is invalid or rejected.
+	ErrMFAFailed = errors.New("mfa failed")
+	// ErrSiteChanged is returned when an expected element is missing from a page, the site has likely changed.
+	ErrSiteChanged = errors.New("site changed")
+	// ErrSiteUnavailable is returned when the site cannot be reached or is under maintenance.
+	ErrSiteUnavailable = errors.New("site unavailable")
+	// ErrInvalidDocument is returned when a downloaded file is not the expected document, e.g. an HTML error page
+	// served after the session expired.
+	ErrInvalidDocument = errors.New("invalid document")
+	// ErrNoDocument is returned when no document matches the selected period.
+	ErrNoDocument = errors.New("no document")
+)
+
+// Exit codes of the process, by category. They are documented in the README.
+const (
+	ExitOK                  = 0
+	ExitFailure             = 1
+	ExitBadCredentials      = 3
+	ExitInteractionRequired = 4
+	ExitMFAFailed           = 5
+	ExitSiteChanged         = 6
+	ExitSiteUnavailable     = 7
+	ExitNoDocument          = 8
+	ExitTimeout             = 9
+	ExitInvalidDocument     = 10
+	ExitInterrupted         = 130
+)
+
+// codes maps categories to exit codes. When err holds several categories, e.g. after several providers failed,
+// the first one wins: an interrupted run first, as the failures it caused are not meaningful,
+// then those needing a human.
+var codes = []struct {
+	err  error
+	code int
+}{
+	{context.Canceled, ExitInterrupted},
+	{context.DeadlineExceeded, ExitTimeout},
+	{ErrBadCredentials, ExitBadCredentials},
+	{ErrMFAFailed, ExitMFAFailed},
+	{ErrInteractionRequired, ExitInteractionRequired},
+	{ErrSiteChanged, ExitSiteChanged},
+	{ErrSiteUnavailable, ExitSiteUnavailable},
+	{ErrInvalidDocument, ExitInvalidDocument},
+	{ErrNoDocument, ExitNoDocument},
+}
+
+// ExitCode returns the exit code matching the category of err.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+
+	return ExitFailure
+}
+
+// Categorised reports whether err already belongs to a category.
+func Categorised(err error) bool {
+	return ExitCode(err) != ExitFailure
+}
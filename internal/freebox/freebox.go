@@ -1,24 +1,52 @@
 package freebox
 
 import (
+	"context"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
 	"github.com/Crocmagnon/downloader-go/internal/pw"
 	"github.com/playwright-community/playwright-go"
-	"io"
+	"strings"
 )
 
-func Run(stdout, stderr io.Writer, headless bool, username, password, dir string) error {
-	return pw.Run(stdout, stderr, headless, pw.BrowserFirefox, func(page playwright.Page) error {
-		return downloadFile(page, username, password, dir)
+// Provider implements provider.Provider for Freebox.
+type Provider struct{}
+
+func (Provider) Name() string { return "freebox" }
+
+func (Provider) Description() string { return "Download latest invoice from Freebox." }
+
+func (Provider) DocumentTypes() []provider.DocumentType {
+	return []provider.DocumentType{provider.DocumentInvoice}
+}
+
+func (Provider) Browser() pw.Browser { return pw.BrowserFirefox }
+
+func (Provider) CredentialFields() []provider.CredentialField {
+	return provider.UsernamePassword("Freebox")
+}
+
+func (Provider) Run(ctx context.Context, opts provider.Options) (provider.Result, error) {
+	return provider.Run(ctx, opts, func(page playwright.Page, session *pw.Session, opts provider.Options) error {
+		return downloadFile(page, session, opts.Credentials.Username(), opts.Credentials.Password(), opts)
 	})
 }
 
-func downloadFile(page playwright.Page, identifier, password, outputDir string) error {
+func downloadFile(page playwright.Page, session *pw.Session, identifier, password string, opts provider.Options) error {
+	opts.Log().Info("logging in")
+
 	if err := login(page, identifier, password); err != nil {
 		return fmt.Errorf("logging in: %w", err)
 	}
 
-	if err := downloadAndSave(page, outputDir); err != nil {
+	opts.Log().Info("logged in")
+
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	if err := downloadAndSave(page, opts); err != nil {
 		return fmt.Errorf("downloading and saving: %w", err)
 	}
 
@@ -26,9 +54,11 @@ func downloadFile(page playwright.Page, identifier, password, outputDir string)
 }
 
 func login(page playwright.Page, identifier, password string) error {
-	_, err := page.Goto("https://subscribe.free.fr/login/")
+	const loginURL = "https://subscribe.free.fr/login/"
+
+	err := pw.Goto(page, loginURL)
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
 	if err := page.Locator("#login_b").Fill(identifier); err != nil {
@@ -43,11 +73,11 @@ func login(page playwright.Page, identifier, password string) error {
 		return fmt.Errorf("clicking login button: %w", err)
 	}
 
-	return nil
+	loggedIn := func(url string) bool { return !strings.HasPrefix(url, loginURL) }
+
+	return pw.WaitForLogin(page, loggedIn, loginURL, errs.ErrBadCredentials)
 }
 
-func downloadAndSave(page playwright.Page, outputDir string) error {
-	return pw.Download(page, outputDir, func() error {
-		return page.Locator("#widget_mesfactures .btn_download").First().Click()
-	})
+func downloadAndSave(page playwright.Page, opts provider.Options) error {
+	return provider.Download(page, opts, pw.Listing{Buttons: page.Locator("#widget_mesfactures .btn_download")})
 }
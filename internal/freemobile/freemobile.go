@@ -1,62 +1,93 @@
 package freemobile
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
 	"github.com/Crocmagnon/downloader-go/internal/pw"
 	"github.com/playwright-community/playwright-go"
 	"io"
+	"log/slog"
 )
 
-var (
-	ErrInteractionRequired = errors.New("interaction is required")
-	ErrInvalidMFA          = errors.New("invalid mfa")
-)
+// Provider implements provider.Provider for Free mobile.
+type Provider struct{}
+
+func (Provider) Name() string { return "free-mobile" }
+
+func (Provider) Description() string { return "Download latest invoice from Free mobile." }
+
+func (Provider) DocumentTypes() []provider.DocumentType {
+	return []provider.DocumentType{provider.DocumentInvoice}
+}
+
+func (Provider) Browser() pw.Browser { return pw.BrowserFirefox }
 
-func Run(stdout, stderr io.Writer, stdin io.Reader, headless bool, username, password, dir string, noInteraction bool) error {
-	return pw.Run(stdout, stderr, headless, pw.BrowserFirefox, func(page playwright.Page) error {
+func (Provider) CredentialFields() []provider.CredentialField {
+	return provider.UsernamePassword("Free mobile")
+}
+
+func (Provider) Run(ctx context.Context, opts provider.Options) (provider.Result, error) {
+	return provider.Run(ctx, opts, func(page playwright.Page, session *pw.Session, opts provider.Options) error {
 		return downloadFile(
+			ctx,
 			page,
-			username,
-			password,
-			dir,
-			noInteraction,
-			stdout,
-			stdin,
+			session,
+			opts.Credentials.Username(),
+			opts.Credentials.Password(),
+			opts,
 		)
 	})
 }
 
 func downloadFile(
+	ctx context.Context,
 	page playwright.Page,
-	identifier, password, outputDir string,
-	noInteraction bool,
-	stdout io.Writer,
-	stdin io.Reader,
+	session *pw.Session,
+	identifier, password string,
+	opts provider.Options,
 ) error {
-	if err := login(page, identifier, password, noInteraction, stdout, stdin); err != nil {
+	opts.Log().Info("logging in")
+
+	if err := login(ctx, page, identifier, password, opts.NoInteraction, opts.Stderr, opts.Stdin, opts.Log()); err != nil {
 		return fmt.Errorf("logging in: %w", err)
 	}
 
+	opts.Log().Info("logged in")
+
+	if err := session.Save(); err != nil {
+		return err
+	}
+
 	if err := navigate(page); err != nil {
 		return fmt.Errorf("navigating: %w", err)
 	}
 
-	if err := downloadAndSave(page, outputDir); err != nil {
+	if err := downloadAndSave(page, opts); err != nil {
 		return fmt.Errorf("downloading and saving: %w", err)
 	}
 
 	return nil
 }
 
-func login(page playwright.Page, identifier, password string, noInteraction bool, stdout io.Writer, stdin io.Reader) error {
-	_, err := page.Goto("https://mobile.free.fr/account/v2/login/")
+func login(
+	ctx context.Context,
+	page playwright.Page,
+	identifier, password string,
+	noInteraction bool,
+	stdout io.Writer,
+	stdin io.Reader,
+	logger *slog.Logger,
+) error {
+	err := pw.Goto(page, "https://mobile.free.fr/account/v2/login/")
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
 	err = page.WaitForURL("https://mobile.free.fr/account/v2", playwright.PageWaitForURLOptions{Timeout: playwright.Float(2000)})
 	if nil == err {
+		logger.Debug("session still valid")
 		return nil // already logged in
 	}
 
@@ -72,54 +103,94 @@ func login(page playwright.Page, identifier, password string, noInteraction bool
 		return fmt.Errorf("clicking login button: %w", err)
 	}
 
-	if err := handleMFA(page, noInteraction, stdout, stdin); err != nil {
+	submitted, err := handleMFA(ctx, page, noInteraction, stdout, stdin, logger)
+	if err != nil {
 		return fmt.Errorf("handling mfa: %w", err)
 	}
 
-	return nil
+	rejected := errs.ErrBadCredentials
+	if submitted {
+		rejected = errs.ErrMFAFailed
+	}
+
+	return pw.WaitForLogin(page, "https://mobile.free.fr/account/v2", "https://mobile.free.fr/account/v2/login", rejected)
 }
 
-func handleMFA(page playwright.Page, noInteraction bool, stdout io.Writer, stdin io.Reader) error {
+func handleMFA(
+	ctx context.Context,
+	page playwright.Page,
+	noInteraction bool,
+	stdout io.Writer,
+	stdin io.Reader,
+	logger *slog.Logger,
+) (bool, error) {
 	mfaLoginValidate := page.Locator("#auth-2FA-validate")
 	if err := playwright.NewPlaywrightAssertions().Locator(mfaLoginValidate).ToBeVisible(); err != nil {
 		// no need for 2FA
-		return nil
+		return false, nil
 	}
 
+	logger.Info("2FA code required")
+
 	if noInteraction {
-		return ErrInteractionRequired
+		return false, fmt.Errorf("%w: 2FA code", errs.ErrInteractionRequired)
 	}
 
 	_, _ = fmt.Fprint(stdout, "2FA code: ")
 
-	var mfa string
-
-	_, err := fmt.Fscanln(stdin, &mfa)
+	mfa, err := readMFA(ctx, stdin)
 	if err != nil {
-		return fmt.Errorf("reading 2FA code from input: %w", err)
+		return false, fmt.Errorf("reading 2FA code from input: %w", err)
 	}
 
 	if len(mfa) != 6 {
-		return fmt.Errorf("%w, expected len 6, got %d", ErrInvalidMFA, len(mfa))
+		return false, fmt.Errorf("%w: invalid code, expected len 6, got %d", errs.ErrMFAFailed, len(mfa))
 	}
 
 	inputs := page.Locator("input[type=number]")
 
 	for i, char := range mfa {
 		if err := inputs.Nth(i).Fill(string(char)); err != nil {
-			return fmt.Errorf("filling %dth input: %w", i, err)
+			return false, fmt.Errorf("filling %dth input: %w", i, err)
 		}
 	}
 
 	// remember me
 	if err := page.Locator("span[role=checkbox]").Click(); err != nil {
-		return fmt.Errorf("clicking remember me: %w", err)
+		return false, fmt.Errorf("clicking remember me: %w", err)
 	}
 
 	if err := mfaLoginValidate.Click(); err != nil {
-		return fmt.Errorf("validating mfa: %w", err)
+		return false, fmt.Errorf("validating mfa: %w", err)
+	}
+
+	logger.Info("2FA code submitted")
+
+	return true, nil
+}
+
+// readMFA reads the MFA code from stdin, giving up when ctx is done.
+func readMFA(ctx context.Context, stdin io.Reader) (string, error) {
+	type result struct {
+		mfa string
+		err error
+	}
+
+	read := make(chan result, 1)
+
+	go func() {
+		var mfa string
+
+		_, err := fmt.Fscanln(stdin, &mfa)
+		read <- result{mfa: mfa, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-read:
+		return res.mfa, res.err
 	}
-	return nil
 }
 
 func navigate(page playwright.Page) error {
@@ -129,8 +200,6 @@ func navigate(page playwright.Page) error {
 	return nil
 }
 
-func downloadAndSave(page playwright.Page, outputDir string) error {
-	return pw.Download(page, outputDir, func() error {
-		return page.Locator("[download]").First().Click()
-	})
+func downloadAndSave(page playwright.Page, opts provider.Options) error {
+	return provider.Download(page, opts, pw.Listing{Buttons: page.Locator("[download]")})
 }
@@ -1,24 +1,51 @@
 package lclchecking
 
 import (
+	"context"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
 	"github.com/Crocmagnon/downloader-go/internal/pw"
 	"github.com/playwright-community/playwright-go"
-	"io"
 )
 
-func Run(stdout, stderr io.Writer, headless bool, username, password, dir string) error {
-	return pw.Run(stdout, stderr, headless, pw.BrowserFirefox, func(page playwright.Page) error {
-		return downloadFile(page, username, password, dir)
+// Provider implements provider.Provider for LCL.
+type Provider struct{}
+
+func (Provider) Name() string { return "lcl-checking" }
+
+func (Provider) Description() string { return "Download latest bank statement from LCL." }
+
+func (Provider) DocumentTypes() []provider.DocumentType {
+	return []provider.DocumentType{provider.DocumentBankStatement}
+}
+
+func (Provider) Browser() pw.Browser { return pw.BrowserFirefox }
+
+func (Provider) CredentialFields() []provider.CredentialField {
+	return provider.UsernamePassword("LCL")
+}
+
+func (Provider) Run(ctx context.Context, opts provider.Options) (provider.Result, error) {
+	return provider.Run(ctx, opts, func(page playwright.Page, session *pw.Session, opts provider.Options) error {
+		return downloadFile(page, session, opts.Credentials.Username(), opts.Credentials.Password(), opts)
 	})
 }
 
-func downloadFile(page playwright.Page, identifier, password, outputDir string) error {
+func downloadFile(page playwright.Page, session *pw.Session, identifier, password string, opts provider.Options) error {
+	opts.Log().Info("logging in")
+
 	if err := login(page, identifier, password); err != nil {
 		return fmt.Errorf("logging in: %w", err)
 	}
 
-	if err := downloadAndSave(page, outputDir); err != nil {
+	opts.Log().Info("logged in")
+
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	if err := downloadAndSave(page, opts); err != nil {
 		return fmt.Errorf("downloading and saving: %w", err)
 	}
 
@@ -26,9 +53,11 @@ func downloadFile(page playwright.Page, identifier, password, outputDir string)
 }
 
 func login(page playwright.Page, identifier, password string) error {
-	_, err := page.Goto("https://monespace.lcl.fr/connexion")
+	const loginURL = "https://monespace.lcl.fr/connexion"
+
+	err := pw.Goto(page, loginURL)
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
 	// we don't care about this error, if the privacy policy is not there no need to reject
@@ -52,20 +81,16 @@ func login(page playwright.Page, identifier, password string) error {
 		return fmt.Errorf("clicking login button: %w", err)
 	}
 
-	err = page.WaitForURL("https://monespace.lcl.fr/synthese/compte", playwright.PageWaitForURLOptions{Timeout: playwright.Float(30000)})
-	if err != nil {
-		return fmt.Errorf("waiting for redirect: %w", err)
-	}
-
-	return nil
+	return pw.WaitForLogin(page, "https://monespace.lcl.fr/synthese/compte", loginURL, errs.ErrBadCredentials)
 }
 
-func downloadAndSave(page playwright.Page, outputDir string) error {
-	if _, err := page.Goto("https://monespace.lcl.fr/mes-documents/releves-de-compte-de-depot"); err != nil {
-		return fmt.Errorf("going to: %w", err)
+func downloadAndSave(page playwright.Page, opts provider.Options) error {
+	if err := pw.Goto(page, "https://monespace.lcl.fr/mes-documents/releves-de-compte-de-depot"); err != nil {
+		return err
 	}
 
-	return pw.Download(page, outputDir, func() error {
-		return page.Locator("button.amount").First().Click()
+	return provider.Download(page, opts, pw.Listing{
+		Buttons: page.Locator("button.amount"),
+		Next:    page.Locator("button[aria-label='Page suivante']"),
 	})
 }
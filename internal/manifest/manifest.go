@@ -0,0 +1,172 @@
+// Package manifest records the documents already downloaded, so that they are only saved once.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/atomicfile"
+	"github.com/Crocmagnon/downloader-go/internal/xdg"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Entry describes a saved document.
+type Entry struct {
+	Provider string `json:"provider"`
+	Account  string `json:"account,omitempty"`
+	// ID identifies the document on the provider site: the file name it suggested.
+	ID string `json:"id"`
+	// Date is the date of the document as listed by the provider, formatted as 2006-01-02. It is empty when unknown.
+	Date string `json:"date,omitempty"`
+	// Path is where the document was saved, relative to the output directory.
+	Path    string    `json:"path"`
+	SHA256  string    `json:"sha256"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// FileSum returns the hex-encoded SHA-256 of the file at path, as recorded in Entry.SHA256.
+func FileSum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Manifest is the list of saved documents, stored as a JSON file.
+type Manifest struct {
+	path string
+
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// DefaultPath returns the location of the manifest, under the XDG state directory.
+func DefaultPath() string {
+	return xdg.StateDir("manifest.json")
+}
+
+// Load reads the manifest at path. A missing file is an empty manifest, created on the first Add.
+func Load(path string) (*Manifest, error) {
+	manifest := &Manifest{path: path}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &manifest.entries); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", path, err)
+	}
+
+	return manifest, nil
+}
+
+// Entries returns a copy of the entries of the manifest.
+func (m *Manifest) Entries() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.entries)
+}
+
+// Scope returns the part of the manifest holding the documents of an account of a provider.
+func (m *Manifest) Scope(provider, account string) *Scope {
+	if m == nil {
+		return nil
+	}
+
+	return &Scope{manifest: m, provider: provider, account: account}
+}
+
+// Scope is the part of a manifest holding the documents of an account of a provider.
+// A nil scope holds nothing and records nothing.
+type Scope struct {
+	manifest *Manifest
+	provider string
+	account  string
+}
+
+// HasDocument reports whether the document identified by id and dated date, formatted as 2006-01-02, was already
+// saved. Sites may suggest the same name for every document, so undated documents never match: they are told apart
+// by their content, see HasSum.
+func (s *Scope) HasDocument(id, date string) bool {
+	if date == "" {
+		return false
+	}
+
+	return s.has(func(entry Entry) bool { return entry.ID == id && entry.Date == date })
+}
+
+// HasSum reports whether a document with the given SHA-256, hex-encoded, was already saved.
+func (s *Scope) HasSum(sum string) bool {
+	return s.has(func(entry Entry) bool { return entry.SHA256 == sum })
+}
+
+func (s *Scope) has(match func(Entry) bool) bool {
+	if s == nil {
+		return false
+	}
+
+	s.manifest.mu.Lock()
+	defer s.manifest.mu.Unlock()
+
+	return slices.ContainsFunc(s.manifest.entries, func(entry Entry) bool {
+		return entry.Provider == s.provider && entry.Account == s.account && match(entry)
+	})
+}
+
+// Add records entry for the provider and account of the scope, and saves the manifest.
+func (s *Scope) Add(entry Entry) error {
+	if s == nil {
+		return nil
+	}
+
+	entry.Provider = s.provider
+	entry.Account = s.account
+
+	s.manifest.mu.Lock()
+	defer s.manifest.mu.Unlock()
+
+	s.manifest.entries = append(s.manifest.entries, entry)
+
+	return s.manifest.save()
+}
+
+// save writes the manifest to a temporary file renamed over the previous one, so that it is never left truncated.
+func (m *Manifest) save() error {
+	content, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling manifest: %w", err)
+	}
+
+	const dirPerm = 0o700
+	if err := os.MkdirAll(filepath.Dir(m.path), dirPerm); err != nil {
+		return fmt.Errorf("creating manifest directory: %w", err)
+	}
+
+	if err := atomicfile.Write(m.path, content); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	return nil
+}
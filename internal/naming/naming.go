@@ -0,0 +1,204 @@
+// Package naming builds the file names of saved documents from templates.
+package naming
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTemplate = errors.New("invalid filename template")
+	ErrUnknownLayout   = errors.New("unknown layout")
+)
+
+// Default is the template used when neither the configuration nor the provider set one.
+const Default = "{date:2006-01}-{provider}-{type}-{account}.{ext}"
+
+// Layout is the directory structure documents are saved in, below the output directory.
+type Layout string
+
+const (
+	// LayoutFlat saves documents where their template names them, directly in the output directory by default.
+	LayoutFlat Layout = "flat"
+	// LayoutStructured saves documents in provider/account/year directories.
+	LayoutStructured Layout = "structured"
+)
+
+// Layouts lists the valid layouts.
+var Layouts = []Layout{LayoutFlat, LayoutStructured}
+
+// ParseLayout returns the layout named name.
+func ParseLayout(name string) (Layout, error) {
+	if !slices.Contains(Layouts, Layout(name)) {
+		return "", fmt.Errorf("%w: %q", ErrUnknownLayout, name)
+	}
+
+	return Layout(name), nil
+}
+
+// Fields are the values interpolated in a template.
+type Fields struct {
+	Provider string
+	Account  string
+	Type     string
+	// Date is the date of the document. Documents without a date are dated when named.
+	Date time.Time
+	// Original is the file name suggested by the provider site.
+	Original string
+}
+
+// Template is a file name template such as {provider}/{year}/{date:2006-01}-{type}-{account}.{ext}.
+// Placeholders are provider, account, type, date (formatted with an optional Go layout, 2006-01-02 by default),
+// year, month, day, name (the suggested file name without extension) and ext. Slashes create directories.
+type Template struct {
+	raw string
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+// Parse checks template and returns it.
+func Parse(template string) (Template, error) {
+	if template == "" || path.IsAbs(template) || filepath.IsAbs(template) {
+		return Template{}, fmt.Errorf("%w: %q must be a relative path", ErrInvalidTemplate, template)
+	}
+
+	for _, part := range strings.Split(template, "/") {
+		if part == ".." {
+			return Template{}, fmt.Errorf("%w: %q must stay in the output directory", ErrInvalidTemplate, template)
+		}
+	}
+
+	for _, match := range placeholder.FindAllStringSubmatch(template, -1) {
+		if _, ok := values(Fields{})[match[1]]; !ok && match[1] != "date" {
+			return Template{}, fmt.Errorf("%w: unknown placeholder %s in %q", ErrInvalidTemplate, match[0], template)
+		}
+
+		if match[2] != "" && match[1] != "date" {
+			return Template{}, fmt.Errorf("%w: only date takes a layout, in %q", ErrInvalidTemplate, template)
+		}
+	}
+
+	if rest := placeholder.ReplaceAllString(template, ""); strings.ContainsAny(rest, "{}") {
+		return Template{}, fmt.Errorf("%w: unbalanced braces in %q", ErrInvalidTemplate, template)
+	}
+
+	return Template{raw: template}, nil
+}
+
+// MustParse is like Parse but panics on error, for templates defined in code.
+func MustParse(template string) Template {
+	tmpl, err := Parse(template)
+	if err != nil {
+		panic(err)
+	}
+
+	return tmpl
+}
+
+func (t Template) String() string {
+	return t.raw
+}
+
+// In returns the template naming documents as t does, in the directories of layout.
+func (t Template) In(layout Layout) Template {
+	if layout == LayoutStructured {
+		return Template{raw: "{provider}/{account}/{year}/" + t.raw}
+	}
+
+	return t
+}
+
+// Execute returns the file name of the document described by fields, relative to the output directory.
+// Every interpolated value is sanitised so that it cannot add directories or characters invalid in file names.
+func (t Template) Execute(fields Fields) string {
+	if fields.Date.IsZero() {
+		fields.Date = time.Now()
+	}
+
+	vals := values(fields)
+
+	name := placeholder.ReplaceAllStringFunc(t.raw, func(match string) string {
+		sub := placeholder.FindStringSubmatch(match)
+
+		value := vals[sub[1]]
+		if sub[1] == "date" {
+			value = fields.Date.Format(cmp.Or(sub[2], time.DateOnly))
+		}
+
+		if value = Sanitise(value); value == "" {
+			return empty
+		}
+
+		return value
+	})
+
+	return tidy(name)
+}
+
+// Namer returns a function naming the documents of fields from their suggested name and date, see pw.Output.
+func (t Template) Namer(fields Fields) func(suggested string, date time.Time) string {
+	return func(suggested string, date time.Time) string {
+		fields := fields
+		fields.Original = suggested
+		fields.Date = date
+
+		return t.Execute(fields)
+	}
+}
+
+func values(fields Fields) map[string]string {
+	ext := filepath.Ext(fields.Original)
+
+	return map[string]string{
+		"provider": fields.Provider,
+		"account":  fields.Account,
+		"type":     fields.Type,
+		"year":     fields.Date.Format("2006"),
+		"month":    fields.Date.Format("01"),
+		"day":      fields.Date.Format("02"),
+		"name":     strings.TrimSuffix(fields.Original, ext),
+		"ext":      strings.TrimPrefix(ext, "."),
+	}
+}
+
+var invalidChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f\x7f]+`)
+
+// Sanitise makes value safe to use as a single file name component.
+func Sanitise(value string) string {
+	value = invalidChars.ReplaceAllString(value, "_")
+	value = strings.Join(strings.Fields(value), " ")
+
+	return strings.Trim(value, ". ")
+}
+
+// empty marks empty values until tidy removes them with their separator.
+const empty = "\x00"
+
+var (
+	separatorBefore = regexp.MustCompile(`[-_ ]` + empty)
+	separatorAfter  = regexp.MustCompile(empty + `[-_ ]?`)
+	emptyDir        = regexp.MustCompile(`/{2,}`)
+)
+
+// tidy removes empty values along with a separator next to them, e.g. the dash before an empty account.
+// Names left without a base name, e.g. freebox/2026/ or .pdf, are named document, as pw does with empty names.
+func tidy(name string) string {
+	name = separatorBefore.ReplaceAllString(name, "")
+	name = separatorAfter.ReplaceAllString(name, "")
+	name = emptyDir.ReplaceAllString(name, "/")
+	name = strings.TrimLeft(name, "/")
+
+	dir, base := path.Split(name)
+	if base = strings.TrimRight(base, ". "); base == "" || strings.HasPrefix(base, ".") {
+		base = "document" + base
+	}
+
+	return dir + base
+}
@@ -0,0 +1,122 @@
+package naming
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		Default,
+		"{provider}/{year}/{date:2006-01}-{type}-{account}.{ext}",
+		"{name}.{ext}",
+		"archive/{date:Jan 2006}.{ext}",
+	}
+
+	for _, template := range valid {
+		if _, err := Parse(template); err != nil {
+			t.Errorf("%q: %v", template, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/srv/{name}.{ext}",
+		"../{name}.{ext}",
+		"{provider}/../../{name}",
+		"{unknown}.{ext}",
+		"{name:2006}.{ext}",
+		"{name.{ext}",
+		"{name}}.{ext}",
+	}
+
+	for _, template := range invalid {
+		if _, err := Parse(template); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("%q: got %v, want %v", template, err, ErrInvalidTemplate)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	fields := Fields{
+		Provider: "freebox",
+		Account:  "home",
+		Type:     "invoice",
+		Date:     time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC),
+		Original: "facture_12345.pdf",
+	}
+	noAccount := fields
+	noAccount.Account = ""
+
+	tests := []struct {
+		template string
+		fields   Fields
+		want     string
+	}{
+		{Default, fields, "2024-03-freebox-invoice-home.pdf"},
+		{"{provider}/{year}/{month}/{day}-{name}.{ext}", fields, "freebox/2024/03/05-facture_12345.pdf"},
+		{"{date}.{ext}", fields, "2024-03-05.pdf"},
+		{"{date:Jan 2006}.{ext}", fields, "Mar 2024.pdf"},
+		// Empty values are removed along with a separator next to them.
+		{Default, noAccount, "2024-03-freebox-invoice.pdf"},
+		{"{account}-{provider}_{type}.{ext}", noAccount, "freebox_invoice.pdf"},
+		{"{provider} {account} {type}.{ext}", noAccount, "freebox invoice.pdf"},
+		{"{provider}/{account}/{year}/{name}.{ext}", noAccount, "freebox/2024/facture_12345.pdf"},
+		{"{account}/{name}.{ext}", noAccount, "facture_12345.pdf"},
+		// Documents are never named after a directory or a bare extension.
+		{"{provider}/{year}/{account}", noAccount, "freebox/2024/document"},
+		{"{account}.{ext}", noAccount, "document.pdf"},
+		{"{name}", Fields{Provider: "freebox", Date: fields.Date}, "document"},
+	}
+
+	for _, test := range tests {
+		if got := MustParse(test.template).Execute(test.fields); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.template, got, test.want)
+		}
+	}
+}
+
+func TestExecuteSanitisesValues(t *testing.T) {
+	fields := Fields{
+		Provider: "free",
+		Account:  "../../etc",
+		Type:     "a/b",
+		Date:     time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC),
+		Original: `..\..\x:y?.pdf`,
+	}
+
+	tests := map[string]string{
+		"{account}/{name}.{ext}":  "_.._etc/_.._x_y_.pdf",
+		"{type}-{provider}.{ext}": "a_b-free.pdf",
+		"{account}":               "_.._etc",
+	}
+
+	for template, want := range tests {
+		if got := MustParse(template).Execute(fields); got != want {
+			t.Errorf("%q: got %q, want %q", template, got, want)
+		}
+	}
+
+	// Values made of dots only are emptied rather than leading up a directory.
+	fields.Account = ".."
+	if got := MustParse("{provider}/{account}/{name}.{ext}").Execute(fields); got != "free/_.._x_y_.pdf" {
+		t.Errorf("got %q, want %q", got, "free/_.._x_y_.pdf")
+	}
+}
+
+func TestIn(t *testing.T) {
+	fields := Fields{Provider: "freebox", Type: "invoice", Date: time.Date(2024, time.March, 5, 0, 0, 0, 0, time.UTC), Original: "f.pdf"}
+
+	if got := MustParse(Default).In(LayoutStructured).Execute(fields); got != "freebox/2024/2024-03-freebox-invoice.pdf" {
+		t.Errorf("structured: got %q", got)
+	}
+
+	if got := MustParse(Default).In(LayoutFlat).Execute(fields); got != "2024-03-freebox-invoice.pdf" {
+		t.Errorf("flat: got %q", got)
+	}
+
+	if _, err := ParseLayout("nested"); !errors.Is(err, ErrUnknownLayout) {
+		t.Errorf("got %v, want %v", err, ErrUnknownLayout)
+	}
+}
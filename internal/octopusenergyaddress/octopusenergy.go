@@ -1,25 +1,88 @@
 package octopusenergyaddress
 
 import (
+	"context"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/naming"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
 	"github.com/Crocmagnon/downloader-go/internal/pw"
 	"github.com/playwright-community/playwright-go"
-	"io"
+	"log/slog"
 	"regexp"
+	"time"
 )
 
-func Run(stdout, stderr io.Writer, headless bool, username, password, dir string) error {
-	return pw.Run(stdout, stderr, headless, pw.BrowserChromium, func(page playwright.Page) error {
-		return downloadFile(page, username, password, dir)
+// Provider implements provider.Provider for Octopus Energy.
+type Provider struct{}
+
+func (Provider) Name() string { return "octopus-energy-address" }
+
+func (Provider) Description() string { return "Download latest proof of address from Octopus Energy." }
+
+func (Provider) DocumentTypes() []provider.DocumentType {
+	return []provider.DocumentType{provider.DocumentProofOfAddress}
+}
+
+func (Provider) Browser() pw.Browser { return pw.BrowserChromium }
+
+func (Provider) CredentialFields() []provider.CredentialField {
+	return provider.UsernamePassword("Octopus Energy")
+}
+
+const (
+	settingFilename = "filename"
+	defaultFilename = "justificatif domicile.pdf"
+)
+
+func (Provider) Settings() []provider.Setting {
+	return []provider.Setting{
+		{Name: settingFilename, Help: "Name suggested for the proof of address, {name} in file name templates, defaults to " + defaultFilename},
+	}
+}
+
+// FilenameTemplate dates proofs of address by day, they are generated on demand.
+func (Provider) FilenameTemplate() naming.Template {
+	return naming.MustParse("{date:2006-01-02}-{provider}-{type}-{account}.{ext}")
+}
+
+func (Provider) Run(ctx context.Context, opts provider.Options) (provider.Result, error) {
+	filename := opts.Settings[settingFilename]
+	if filename == "" {
+		filename = defaultFilename
+	}
+
+	// The proof of address is generated on demand, dated today.
+	if !opts.Period.Contains(time.Now()) {
+		return provider.Result{}, fmt.Errorf("%w: %s", pw.ErrNoDocument, opts.Period)
+	}
+
+	return provider.Run(ctx, opts, func(page playwright.Page, session *pw.Session, opts provider.Options) error {
+		return downloadFile(page, session, opts.Credentials.Username(), opts.Credentials.Password(), opts.Output(), filename, opts.Log())
 	})
 }
 
-func downloadFile(page playwright.Page, identifier, password, outputDir string) error {
+func downloadFile(
+	page playwright.Page,
+	session *pw.Session,
+	identifier, password string,
+	out pw.Output,
+	filename string,
+	logger *slog.Logger,
+) error {
+	logger.Info("logging in")
+
 	if err := login(page, identifier, password); err != nil {
 		return fmt.Errorf("logging in: %w", err)
 	}
 
-	if err := downloadAndSave(page, outputDir); err != nil {
+	logger.Info("logged in")
+
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	if err := downloadAndSave(page, out, filename); err != nil {
 		return fmt.Errorf("downloading and saving: %w", err)
 	}
 
@@ -27,9 +90,11 @@ func downloadFile(page playwright.Page, identifier, password, outputDir string)
 }
 
 func login(page playwright.Page, identifier, password string) error {
-	_, err := page.Goto("https://www.octopusenergy.fr/connexion")
+	const loginURL = "https://www.octopusenergy.fr/connexion"
+
+	err := pw.Goto(page, loginURL)
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
 	reg := regexp.MustCompile(`^https://www\.octopusenergy\.fr/espace-client/comptes/.*/logements/.*$`)
@@ -52,20 +117,16 @@ func login(page playwright.Page, identifier, password string) error {
 		return fmt.Errorf("clicking login button: %w", err)
 	}
 
-	if err := page.WaitForURL(reg, playwright.PageWaitForURLOptions{Timeout: playwright.Float(5000)}); err != nil {
-		return fmt.Errorf("waiting for redirect: %w", err)
-	}
-
-	return nil
+	return pw.WaitForLogin(page, reg, loginURL, errs.ErrBadCredentials)
 }
 
-func downloadAndSave(page playwright.Page, outputDir string) error {
-	_, err := page.Goto(page.URL() + "/justificatif-de-domicile")
+func downloadAndSave(page playwright.Page, out pw.Output, filename string) error {
+	err := pw.Goto(page, page.URL()+"/justificatif-de-domicile")
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
-	return pw.DownloadPDFPopup(page, outputDir, "**/*.pdf*", "justificatif domicile.pdf", func() error {
+	return pw.DownloadPDFPopup(page, out, "**/*.pdf*", filename, func() error {
 		return page.Locator("button[type=submit]").First().Click()
 	})
 }
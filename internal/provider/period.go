@@ -0,0 +1,128 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/pw"
+	"github.com/playwright-community/playwright-go"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoDate = errors.New("no date found")
+
+// Period selects documents by date, bounds included. A zero bound leaves that side open.
+type Period struct {
+	Since time.Time
+	Until time.Time
+}
+
+// MonthPeriod returns the period covering the whole month of t.
+func MonthPeriod(t time.Time) Period {
+	since := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return Period{Since: since, Until: since.AddDate(0, 1, -1)}
+}
+
+func (p Period) IsZero() bool {
+	return p.Since.IsZero() && p.Until.IsZero()
+}
+
+// Contains reports whether the day of t is within p.
+func (p Period) Contains(t time.Time) bool {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	return (p.Since.IsZero() || !day.Before(p.Since)) && (p.Until.IsZero() || !day.After(p.Until))
+}
+
+func (p Period) String() string {
+	const layout = "2006-01-02"
+
+	switch {
+	case p.IsZero():
+		return "any date"
+	case p.Until.IsZero():
+		return "since " + p.Since.Format(layout)
+	case p.Since.IsZero():
+		return "until " + p.Until.Format(layout)
+	default:
+		return p.Since.Format(layout) + " to " + p.Until.Format(layout)
+	}
+}
+
+// documentDate returns the date of the document of button, read from its row.
+func documentDate(button playwright.Locator) (time.Time, error) {
+	text, err := pw.RowText(button)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return FindDate(text)
+}
+
+var (
+	numericDate = regexp.MustCompile(`\b(\d{2})/(\d{2})/(\d{4})\b`)
+	monthDate   = regexp.MustCompile(`(?i)\b(janvier|f[ée]vrier|mars|avril|mai|juin|juillet|ao[ûu]t|septembre|octobre|novembre|d[ée]cembre)\s+(\d{4})\b`)
+)
+
+var months = []string{"janvier", "fevrier", "mars", "avril", "mai", "juin", "juillet", "aout", "septembre", "octobre", "novembre", "decembre"}
+
+// FindDate returns the first date found in text, written as dd/mm/yyyy or as a French month and year
+// (e.g. "mars 2024", dated the first of the month), as sites list their documents.
+func FindDate(text string) (time.Time, error) {
+	if match := numericDate.FindStringSubmatch(text); match != nil {
+		date, err := time.Parse("02/01/2006", match[0])
+		if err == nil {
+			return date, nil
+		}
+	}
+
+	if match := monthDate.FindStringSubmatch(text); match != nil {
+		name := strings.NewReplacer("é", "e", "û", "u").Replace(strings.ToLower(match[1]))
+
+		for i, month := range months {
+			if month == name {
+				year, _ := strconv.Atoi(match[2])
+				return time.Date(year, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w in %q", ErrNoDate, text)
+}
+
+// Download downloads the documents of listing within opts.Period: every one not already saved when opts.All is set,
+// otherwise the latest one. It logs when there is nothing new.
+func Download(page playwright.Page, opts Options, listing pw.Listing) error {
+	listing.Date = documentDate
+	if !opts.Period.IsZero() {
+		listing.Keep = opts.Period.Contains
+	}
+
+	var (
+		saved int
+		err   error
+	)
+
+	if opts.All {
+		saved, err = pw.DownloadEach(page, opts.Output(), listing)
+	} else {
+		var ok bool
+
+		ok, err = pw.DownloadFirst(page, opts.Output(), listing)
+		if ok {
+			saved = 1
+		}
+	}
+
+	if errors.Is(err, pw.ErrNoDocument) {
+		return fmt.Errorf("%w: %s", err, opts.Period)
+	}
+
+	if err == nil && saved == 0 {
+		opts.Log().Info("nothing new")
+	}
+
+	return err
+}
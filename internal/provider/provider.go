@@ -0,0 +1,235 @@
+// Package provider defines the interface implemented by every document source.
+package provider
+
+import (
+	"context"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
+	"github.com/Crocmagnon/downloader-go/internal/naming"
+	"github.com/Crocmagnon/downloader-go/internal/pw"
+	"github.com/playwright-community/playwright-go"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DocumentType is the kind of document a provider downloads.
+type DocumentType string
+
+const (
+	DocumentInvoice        DocumentType = "invoice"
+	DocumentPayslip        DocumentType = "payslip"
+	DocumentBankStatement  DocumentType = "bank-statement"
+	DocumentProofOfAddress DocumentType = "proof-of-address"
+)
+
+// AllDocumentTypes lists the kinds of documents providers download.
+var AllDocumentTypes = []DocumentType{DocumentInvoice, DocumentPayslip, DocumentBankStatement, DocumentProofOfAddress}
+
+// CredentialField describes a credential a provider needs to log in.
+type CredentialField struct {
+	Name   string
+	Help   string
+	Secret bool
+}
+
+// Credentials holds the values of the credential fields of a provider, keyed by field name.
+type Credentials map[string]string
+
+func (c Credentials) Username() string { return c["username"] }
+
+func (c Credentials) Password() string { return c["password"] }
+
+// Missing returns the names of fields that have no value in c.
+func (c Credentials) Missing(fields []CredentialField) []string {
+	var missing []string
+
+	for _, field := range fields {
+		if c[field.Name] == "" {
+			missing = append(missing, field.Name)
+		}
+	}
+
+	return missing
+}
+
+// EnvVar returns the name of the environment variable holding field for the provider named providerName,
+// e.g. DOWNLOADER_FREE_MOBILE_PASSWORD.
+func EnvVar(providerName, field string) string {
+	name := "DOWNLOADER_" + providerName + "_" + field
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Options are the settings shared by every provider run.
+type Options struct {
+	// Stderr and Stdin are used for prompts. Progress is logged with Logger.
+	Stderr io.Writer
+	Stdin  io.Reader
+	// Logger logs the steps of the run, with the provider and account as attributes. Nothing is logged when nil.
+	Logger        *slog.Logger
+	Headless      bool
+	NoInteraction bool
+	OutputDir     string
+	Browser       pw.Browser
+	// All downloads every listed document not already saved instead of only the latest one.
+	All bool
+	// Period selects the documents to download by date. Every date is selected when zero.
+	Period Period
+	// Account is the name of the account being run, empty when only one is configured.
+	Account     string
+	Credentials Credentials
+	// Settings are the provider-specific options, see Configurable.
+	Settings map[string]string
+	// SessionFile persists the browser session of the account between runs, see pw.SessionFile.
+	SessionFile   string
+	SessionCipher *pw.SessionCipher
+	// Manifest records the documents saved for the account, see pw.Output.
+	Manifest *manifest.Scope
+	// Filename names the saved documents, see pw.Output. They keep the name suggested by the site when nil.
+	Filename  func(suggested string, date time.Time) string
+	Collision pw.Collision
+	// Sidecar is the metadata written next to saved documents, see pw.Output.
+	Sidecar         *pw.Sidecar
+	DriverDirectory string
+	// ExpectedPages is the page count of the documents, not checked when zero.
+	ExpectedPages int
+	// QuarantineDir keeps the downloads that are not valid documents, see pw.Output.
+	QuarantineDir string
+	// Artifacts configures the bundle saved when the run fails.
+	Artifacts pw.Artifacts
+	// Trace adds a playwright trace of the run to the failure bundle.
+	Trace bool
+	// RecordHAR saves the network exchanges of the run, scrubbed of the credentials.
+	RecordHAR bool
+	// Video records a video of the run, see pw.Options.
+	Video        pw.Video
+	VideoMaxSize int64
+
+	// report collects the outcome of the run, see Run.
+	report *pw.Report
+}
+
+// Log returns the logger of the run, never nil.
+func (o Options) Log() *slog.Logger {
+	if o.Logger == nil {
+		return slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	return o.Logger
+}
+
+// Playwright returns the options to pass to pw.Run.
+func (o Options) Playwright() pw.Options {
+	return pw.Options{
+		Logger:          o.Logger,
+		Headless:        o.Headless,
+		Browser:         o.Browser,
+		SessionFile:     o.SessionFile,
+		SessionCipher:   o.SessionCipher,
+		DriverDirectory: o.DriverDirectory,
+		Report:          o.report,
+		Artifacts:       o.Artifacts,
+		Trace:           o.Trace,
+		RecordHAR:       o.RecordHAR,
+		Video:           o.Video,
+		VideoMaxSize:    o.VideoMaxSize,
+		Secrets:         slices.Collect(maps.Values(o.Credentials)),
+	}
+}
+
+// Output returns where to save documents.
+func (o Options) Output() pw.Output {
+	return pw.Output{
+		Dir:        o.OutputDir,
+		Manifest:   o.Manifest,
+		Name:       o.Filename,
+		Collision:  o.Collision,
+		Sidecar:    o.Sidecar,
+		Report:     o.report,
+		Pages:      o.ExpectedPages,
+		Quarantine: o.QuarantineDir,
+		Logger:     o.Logger,
+	}
+}
+
+// Result is the outcome of a provider run.
+type Result struct {
+	Saved    []pw.Document `json:"saved"`
+	Skipped  []pw.Document `json:"skipped"`
+	Warnings []string      `json:"warnings"`
+	// Artifacts is the directory of the bundle of the run, saved when it failed or a HAR was recorded.
+	Artifacts string `json:"artifacts,omitempty"`
+}
+
+// Run runs callback in a browser like pw.Run, passing it opts set up to collect the documents saved and skipped
+// by Download and the pw helpers, and returns them.
+func Run(
+	ctx context.Context,
+	opts Options,
+	callback func(page playwright.Page, session *pw.Session, opts Options) error,
+) (Result, error) {
+	opts.report = &pw.Report{}
+
+	err := pw.Run(ctx, opts.Playwright(), func(page playwright.Page, session *pw.Session) error {
+		return callback(page, session, opts)
+	})
+
+	return Result(*opts.report), err
+}
+
+// Provider is a source of documents.
+type Provider interface {
+	// Name is the identifier of the provider, used as the command name.
+	Name() string
+	// Description is a one-line summary of what the provider downloads.
+	Description() string
+	DocumentTypes() []DocumentType
+	Browser() pw.Browser
+	CredentialFields() []CredentialField
+	// Run downloads documents and reports those saved and skipped, even on error. It returns early when ctx is done.
+	Run(ctx context.Context, opts Options) (Result, error)
+}
+
+// Setting describes a provider-specific option.
+type Setting struct {
+	Name string
+	Help string
+}
+
+// Configurable is implemented by providers accepting provider-specific options.
+type Configurable interface {
+	Settings() []Setting
+}
+
+// SettingsOf returns the provider-specific options accepted by prov.
+func SettingsOf(prov Provider) []Setting {
+	if configurable, ok := prov.(Configurable); ok {
+		return configurable.Settings()
+	}
+
+	return nil
+}
+
+// Named is implemented by providers whose documents are better named by another template than naming.Default.
+type Named interface {
+	FilenameTemplate() naming.Template
+}
+
+// FilenameTemplate returns the default file name template of the documents of prov.
+func FilenameTemplate(prov Provider) naming.Template {
+	if named, ok := prov.(Named); ok {
+		return named.FilenameTemplate()
+	}
+
+	return naming.MustParse(naming.Default)
+}
+
+// UsernamePassword returns the usual username and password credential fields, labelled with label.
+func UsernamePassword(label string) []CredentialField {
+	return []CredentialField{
+		{Name: "username", Help: label + " username"},
+		{Name: "password", Help: label + " password", Secret: true},
+	}
+}
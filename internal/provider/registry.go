@@ -0,0 +1,37 @@
+package provider
+
+import "fmt"
+
+// Registry is an ordered collection of providers, indexed by name.
+type Registry struct {
+	providers []Provider
+	byName    map[string]Provider
+}
+
+// NewRegistry creates a registry containing providers, in order.
+// It panics if two providers share the same name.
+func NewRegistry(providers ...Provider) *Registry {
+	reg := &Registry{byName: make(map[string]Provider, len(providers))}
+
+	for _, prov := range providers {
+		if _, ok := reg.byName[prov.Name()]; ok {
+			panic(fmt.Sprintf("provider %q registered twice", prov.Name()))
+		}
+
+		reg.providers = append(reg.providers, prov)
+		reg.byName[prov.Name()] = prov
+	}
+
+	return reg
+}
+
+// All returns every registered provider, in registration order.
+func (r *Registry) All() []Provider {
+	return r.providers
+}
+
+// Get returns the provider named name.
+func (r *Registry) Get(name string) (Provider, bool) {
+	prov, ok := r.byName[name]
+	return prov, ok
+}
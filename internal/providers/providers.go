@@ -0,0 +1,22 @@
+// Package providers lists every provider known to the downloader.
+package providers
+
+import (
+	"github.com/Crocmagnon/downloader-go/internal/eaudugrandlyon"
+	"github.com/Crocmagnon/downloader-go/internal/freebox"
+	"github.com/Crocmagnon/downloader-go/internal/freemobile"
+	"github.com/Crocmagnon/downloader-go/internal/lclchecking"
+	"github.com/Crocmagnon/downloader-go/internal/octopusenergyaddress"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"github.com/Crocmagnon/downloader-go/internal/shiva"
+)
+
+// Registry holds every available provider. Add new providers here.
+var Registry = provider.NewRegistry(
+	freebox.Provider{},
+	freemobile.Provider{},
+	eaudugrandlyon.Provider{},
+	octopusenergyaddress.Provider{},
+	shiva.Provider{},
+	lclchecking.Provider{},
+)
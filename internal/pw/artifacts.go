@@ -0,0 +1,208 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/naming"
+	"github.com/Crocmagnon/downloader-go/internal/xdg"
+	"github.com/playwright-community/playwright-go"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// artifactsTime is the layout of the timestamp suffixing bundle directories, sortable by date.
+const artifactsTime = "20060102T150405"
+
+// Artifacts configures the bundles saved when a run fails, to investigate the failure.
+type Artifacts struct {
+	// Dir holds a directory per failed run. No bundle is saved when empty.
+	Dir      string
+	Provider string
+	Account  string
+	// Keep is the number of bundles kept per provider and account. Every bundle is kept when not positive.
+	Keep int
+}
+
+// DefaultArtifactsDir returns the directory holding failure bundles, under the XDG state directory.
+func DefaultArtifactsDir() string {
+	return xdg.StateDir("artifacts")
+}
+
+// prefix returns the beginning of the directory names of the bundles of the provider and account.
+func (a Artifacts) prefix() string {
+	if a.Account == "" {
+		return naming.Sanitise(a.Provider) + "-"
+	}
+
+	return naming.Sanitise(a.Provider) + "-" + naming.Sanitise(a.Account) + "-"
+}
+
+// console records the console messages and uncaught errors of a page.
+type console struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func watchConsole(page playwright.Page) *console {
+	c := &console{}
+
+	page.OnConsole(func(msg playwright.ConsoleMessage) {
+		c.add(fmt.Sprintf("%s %s: %s", time.Now().Format(time.TimeOnly), msg.Type(), msg.Text()))
+	})
+	page.OnPageError(func(err error) {
+		c.add(fmt.Sprintf("%s pageerror: %v", time.Now().Format(time.TimeOnly), err))
+	})
+
+	return c
+}
+
+func (c *console) add(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages = append(c.messages, message)
+}
+
+func (c *console) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return strings.Join(c.messages, "\n")
+}
+
+// bundle returns the directory of the bundle of the run started at started, empty when bundles are not saved.
+func (a Artifacts) bundle(started time.Time) string {
+	if a.Dir == "" {
+		return ""
+	}
+
+	return filepath.Join(a.Dir, a.prefix()+started.Format(artifactsTime))
+}
+
+// save writes to the bundle dir a description of the failure of the run with err: a full-page screenshot,
+// the page HTML and URL, the error chain, the console messages and the trace recorded by tracing if not nil.
+// Files that cannot be captured are left out, the page may be unusable. It does nothing when dir is empty.
+func (a Artifacts) save(dir string, page playwright.Page, err error, messages *console, tracing playwright.Tracing) error {
+	if dir == "" {
+		return nil
+	}
+
+	const dirPerm, filePerm = 0o700, 0o600
+
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return fmt.Errorf("saving failure artifacts: %w", err)
+	}
+
+	files := map[string][]byte{
+		"error.txt":   []byte(errorChain(err)),
+		"url.txt":     []byte(page.URL() + "\n"),
+		"console.log": []byte(messages.String()),
+	}
+
+	if img, err := page.Screenshot(playwright.PageScreenshotOptions{FullPage: playwright.Bool(true)}); err == nil {
+		files["screenshot.png"] = img
+	}
+
+	if html, err := page.Content(); err == nil {
+		files["page.html"] = []byte(html)
+	}
+
+	var problems []error
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, filePerm); err != nil {
+			problems = append(problems, fmt.Errorf("saving failure artifacts: %w", err))
+		}
+	}
+
+	if tracing != nil {
+		problems = append(problems, saveTrace(tracing, filepath.Join(dir, "trace.zip")))
+	}
+
+	return errors.Join(problems...)
+}
+
+// saveTrace stops tracing and saves the trace to path, readable by its owner only since it holds
+// the values typed in the page, passwords included.
+func saveTrace(tracing playwright.Tracing, path string) error {
+	if err := tracing.Stop(path); err != nil {
+		return fmt.Errorf("saving trace: %w", err)
+	}
+
+	const perm = 0o600
+	if err := os.Chmod(path, perm); err != nil {
+		return fmt.Errorf("saving trace: %w", err)
+	}
+
+	return nil
+}
+
+// prune deletes the oldest bundles of the provider and account beyond Keep.
+func (a Artifacts) prune() error {
+	if a.Dir == "" || a.Keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(a.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("pruning artifacts: %w", err)
+	}
+
+	var bundles []string
+
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), a.prefix())
+		if !ok || !entry.IsDir() {
+			continue
+		}
+
+		// Leaves out the bundles of other accounts, whose names share the prefix.
+		if _, err := time.Parse(artifactsTime, stamp); err == nil {
+			bundles = append(bundles, entry.Name())
+		}
+	}
+
+	slices.Sort(bundles)
+
+	for _, bundle := range bundles[:max(0, len(bundles)-a.Keep)] {
+		if err := os.RemoveAll(filepath.Join(a.Dir, bundle)); err != nil {
+			return fmt.Errorf("pruning artifacts: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// errorChain describes err and the errors it wraps, one per line, indented by depth.
+func errorChain(err error) string {
+	var builder strings.Builder
+
+	var walk func(err error, depth int)
+
+	walk = func(err error, depth int) {
+		_, _ = fmt.Fprintf(&builder, "%s%T: %v\n", strings.Repeat("  ", depth), err, err)
+
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			if inner := wrapped.Unwrap(); inner != nil {
+				walk(inner, depth+1)
+			}
+		case interface{ Unwrap() []error }:
+			for _, inner := range wrapped.Unwrap() {
+				walk(inner, depth+1)
+			}
+		}
+	}
+
+	walk(err, 0)
+
+	return builder.String()
+}
@@ -0,0 +1,107 @@
+package pw
+
+import (
+	"bytes"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	ErrWrongSessionKey  = errors.New("wrong session key")
+	ErrCorruptedSession = errors.New("corrupted session file")
+	ErrEncryptedSession = errors.New("session file is encrypted but no session key is configured")
+)
+
+// ageHeader starts every age-encrypted file.
+var ageHeader = []byte("age-encryption.org/")
+
+// SessionCipher encrypts session files at rest with age.
+type SessionCipher struct {
+	recipient age.Recipient
+	identity  age.Identity
+}
+
+// PassphraseCipher returns a cipher deriving its key from passphrase.
+func PassphraseCipher(passphrase string) (*SessionCipher, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("creating session key: %w", err)
+	}
+
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("creating session key: %w", err)
+	}
+
+	return &SessionCipher{recipient: recipient, identity: identity}, nil
+}
+
+// KeyFileCipher returns a cipher using the first X25519 identity of the age key file at path,
+// as generated by age-keygen.
+func KeyFileCipher(path string) (*SessionCipher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening session key file: %w", err)
+	}
+
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("parsing session key file %s: %w", path, err)
+	}
+
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			return &SessionCipher{recipient: x25519.Recipient(), identity: x25519}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("parsing session key file %s: no X25519 identity", path)
+}
+
+func (c *SessionCipher) encrypt(plaintext []byte) ([]byte, error) {
+	var out bytes.Buffer
+
+	writer, err := age.Encrypt(&out, c.recipient)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting session: %w", err)
+	}
+
+	if _, err := writer.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("encrypting session: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("encrypting session: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+func (c *SessionCipher) decrypt(ciphertext []byte) ([]byte, error) {
+	reader, err := age.Decrypt(bytes.NewReader(ciphertext), c.identity)
+
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrWrongSessionKey
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptedSession, err)
+	}
+
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptedSession, err)
+	}
+
+	return plaintext, nil
+}
+
+func isEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, ageHeader)
+}
@@ -0,0 +1,75 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/playwright-community/playwright-go"
+	"net/http"
+	"strings"
+)
+
+// classify adds a category of the errs package to err when it has none, from the playwright error it wraps:
+// elements not showing up mean the site changed, network errors that it is unavailable.
+// Timeouts meaning otherwise are categorised where they happen: navigations by Goto, logins by WaitForLogin,
+// listings and downloads by Listing.
+func classify(err error) error {
+	switch {
+	case errs.Categorised(err):
+		return err
+	case errors.Is(err, playwright.ErrTimeout):
+		return fmt.Errorf("%w: %w", errs.ErrSiteChanged, err)
+	case isNetworkError(err):
+		return fmt.Errorf("%w: %w", errs.ErrSiteUnavailable, err)
+	default:
+		return err
+	}
+}
+
+// isNetworkError reports whether err is a navigation failure, as reported by chromium (net::ERR_*)
+// or firefox (NS_ERROR_*).
+func isNetworkError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "net::ERR_") || strings.Contains(msg, "NS_ERROR_")
+}
+
+// Goto navigates page to url, failing with errs.ErrSiteUnavailable when the site does not load in time or answers
+// with a server error, as it does during maintenance.
+func Goto(page playwright.Page, url string) error {
+	resp, err := page.Goto(url)
+	if errors.Is(err, playwright.ErrTimeout) {
+		return fmt.Errorf("%w: going to %s: %w", errs.ErrSiteUnavailable, url, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("going to %s: %w", url, err)
+	}
+
+	if resp != nil && resp.Status() >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: going to %s: status %d", errs.ErrSiteUnavailable, url, resp.Status())
+	}
+
+	return nil
+}
+
+// loginTimeout is how long sites get to redirect to the account after the login form is submitted, in milliseconds.
+const loginTimeout = 30000
+
+// WaitForLogin waits for page to go to a URL matching loggedIn, as accepted by page.WaitForURL, after the login
+// form was submitted. It fails with rejected, e.g. errs.ErrBadCredentials, when the page is still on the login page,
+// whose URL starts with loginURL, and with errs.ErrSiteChanged when it went elsewhere.
+func WaitForLogin(page playwright.Page, loggedIn any, loginURL string, rejected error) error {
+	err := page.WaitForURL(loggedIn, playwright.PageWaitForURLOptions{
+		Timeout:   playwright.Float(loginTimeout),
+		WaitUntil: playwright.WaitUntilStateCommit,
+	})
+	if err == nil {
+		return nil
+	}
+
+	if url := page.URL(); strings.HasPrefix(strings.ToLower(url), strings.ToLower(loginURL)) {
+		return fmt.Errorf("%w: still on the login page: %w", rejected, err)
+	}
+
+	return fmt.Errorf("%w: waiting for redirect after login, on %s: %w", errs.ErrSiteChanged, page.URL(), err)
+}
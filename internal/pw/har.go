@@ -0,0 +1,250 @@
+package pw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// redacted replaces the scrubbed values of a HAR.
+const redacted = "[redacted]"
+
+// sensitiveHeaders are the headers whose value is scrubbed from HARs, lower-cased.
+var sensitiveHeaders = []string{
+	"authorization",
+	"cookie",
+	"proxy-authorization",
+	"set-cookie",
+	"x-api-key",
+	"x-auth-token",
+	"x-csrf-token",
+	"x-xsrf-token",
+}
+
+// sensitiveKey matches the keys of JSON response bodies whose value is scrubbed from HARs, such as the tokens
+// returned by GraphQL logins.
+var sensitiveKey = regexp.MustCompile(`(?i)token|jwt|secret|passw|session|auth|credential|api_?key|otp`)
+
+// saveHAR writes the HAR at rawPath to path, scrubbed of request bodies, credential headers, cookies, URL query and
+// fragment values, binary and non-JSON text response bodies, token-like values of JSON response bodies and every
+// occurrence of secrets.
+func saveHAR(rawPath, path string, secrets []string) error {
+	content, err := os.ReadFile(rawPath)
+	if err != nil {
+		return fmt.Errorf("reading HAR: %w", err)
+	}
+
+	var har map[string]any
+	if err := json.Unmarshal(content, &har); err != nil {
+		return fmt.Errorf("parsing HAR: %w", err)
+	}
+
+	scrubHAR(har)
+
+	replacer := secretReplacer(secrets)
+	scrubbed := replaceStrings(har, replacer.Replace)
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(scrubbed); err != nil {
+		return fmt.Errorf("marshaling HAR: %w", err)
+	}
+
+	const dirPerm, filePerm = 0o700, 0o600
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return fmt.Errorf("saving HAR: %w", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), filePerm); err != nil {
+		return fmt.Errorf("saving HAR: %w", err)
+	}
+
+	return nil
+}
+
+// scrubHAR scrubs the request bodies, credential headers, cookies, URL query and fragment values and response bodies
+// of har, keeping the non-sensitive values of JSON responses.
+func scrubHAR(har map[string]any) {
+	logs, _ := har["log"].(map[string]any)
+	entries, _ := logs["entries"].([]any)
+
+	for _, entry := range entries {
+		entry, _ := entry.(map[string]any)
+
+		if request, ok := entry["request"].(map[string]any); ok {
+			scrubMessage(request)
+			scrubURL(request, "url")
+
+			params, _ := request["queryString"].([]any)
+			redactValues(params)
+
+			if postData, ok := request["postData"].(map[string]any); ok {
+				postData["text"] = redacted
+
+				params, _ := postData["params"].([]any)
+				redactValues(params)
+			}
+		}
+
+		if response, ok := entry["response"].(map[string]any); ok {
+			scrubMessage(response)
+			scrubURL(response, "redirectURL")
+
+			if content, ok := response["content"].(map[string]any); ok {
+				scrubContent(content)
+			}
+		}
+	}
+}
+
+// scrubMessage scrubs the credential headers and the cookies of a HAR request or response.
+func scrubMessage(message map[string]any) {
+	headers, _ := message["headers"].([]any)
+
+	for _, header := range headers {
+		header, _ := header.(map[string]any)
+		name, _ := header["name"].(string)
+
+		switch name = strings.ToLower(name); {
+		case slices.Contains(sensitiveHeaders, name):
+			header["value"] = redacted
+		case name == "location" || name == "referer":
+			scrubURL(header, "value")
+		}
+	}
+
+	cookies, _ := message["cookies"].([]any)
+	redactValues(cookies)
+}
+
+// scrubURL redacts the query parameter values and the fragment of the URL held by message[key].
+func scrubURL(message map[string]any, key string) {
+	raw, _ := message[key].(string)
+
+	base, fragment, hasFragment := strings.Cut(raw, "#")
+	base, query, hasQuery := strings.Cut(base, "?")
+
+	if hasQuery {
+		params := strings.Split(query, "&")
+		for i, param := range params {
+			if name, _, ok := strings.Cut(param, "="); ok {
+				params[i] = name + "=" + redacted
+			}
+		}
+
+		base += "?" + strings.Join(params, "&")
+	}
+
+	if hasFragment && fragment != "" {
+		base += "#" + redacted
+	}
+
+	if hasQuery || hasFragment {
+		message[key] = base
+	}
+}
+
+// scrubContent scrubs a HAR response body. Binary bodies, such as the downloaded documents, are useless to debug
+// a flow and hold personal data, and text bodies may embed tokens: both are dropped. JSON bodies are kept, without
+// the values of sensitive keys.
+func scrubContent(content map[string]any) {
+	text, _ := content["text"].(string)
+	mimeType, _ := content["mimeType"].(string)
+
+	var body any
+	if text != "" && content["encoding"] == nil && strings.Contains(mimeType, "json") &&
+		json.Unmarshal([]byte(text), &body) == nil {
+		scrubbed, err := json.Marshal(redactKeys(body))
+		if err == nil {
+			content["text"] = string(scrubbed)
+
+			return
+		}
+	}
+
+	delete(content, "text")
+	delete(content, "encoding")
+}
+
+// redactKeys redacts the values of the sensitive keys of a JSON value, at any depth.
+func redactKeys(value any) any {
+	switch value := value.(type) {
+	case []any:
+		for i, item := range value {
+			value[i] = redactKeys(item)
+		}
+	case map[string]any:
+		for key, item := range value {
+			if sensitiveKey.MatchString(key) && item != nil {
+				value[key] = redacted
+			} else {
+				value[key] = redactKeys(item)
+			}
+		}
+	}
+
+	return value
+}
+
+// redactValues redacts the value of each name-value pair of pairs.
+func redactValues(pairs []any) {
+	for _, pair := range pairs {
+		if pair, ok := pair.(map[string]any); ok {
+			pair["value"] = redacted
+		}
+	}
+}
+
+// secretReplacer returns a replacer redacting secrets, as is and encoded in URLs.
+func secretReplacer(secrets []string) *strings.Replacer {
+	var variants []string
+
+	for _, secret := range secrets {
+		if secret != "" {
+			variants = append(variants, secret, url.QueryEscape(secret), url.PathEscape(secret))
+		}
+	}
+
+	// Longest first, so that a secret containing another one is redacted whole.
+	slices.SortFunc(variants, func(a, b string) int { return len(b) - len(a) })
+
+	pairs := make([]string, 0, 2*len(variants))
+	for _, variant := range variants {
+		pairs = append(pairs, variant, redacted)
+	}
+
+	return strings.NewReplacer(pairs...)
+}
+
+// replaceStrings applies replace to every string of the JSON value, keys included.
+func replaceStrings(value any, replace func(string) string) any {
+	switch value := value.(type) {
+	case string:
+		return replace(value)
+	case []any:
+		for i, item := range value {
+			value[i] = replaceStrings(item, replace)
+		}
+
+		return value
+	case map[string]any:
+		replaced := make(map[string]any, len(value))
+		for key, item := range value {
+			replaced[replace(key)] = replaceStrings(item, replace)
+		}
+
+		return replaced
+	default:
+		return value
+	}
+}
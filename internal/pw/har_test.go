@@ -0,0 +1,82 @@
+package pw
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveHAR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle", "network.har")
+
+	if err := saveHAR(filepath.Join("testdata", "network.har"), path, []string{"jane", "p@ss word&1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	har := string(content)
+
+	leaked := []string{
+		"AUTHHEADER", "COOKIEHEADER", "SETCOOKIEHEADER", "REQUESTCOOKIE", "RESPONSECOOKIE",
+		"POSTPASSWORD", "SESSIONQUERY", "FRAGMENTTOKEN", "REFERERQUERY", "REDIRECTQUERY",
+		"JWTVALUE", "REFRESHVALUE", "HTMLBODY", "JVBERi0xLjcK",
+		"jane", "p@ss word&1", "p%40ss+word%261", "p@ss%20word&1",
+	}
+
+	for _, secret := range leaked {
+		if strings.Contains(har, secret) {
+			t.Errorf("HAR holds %q", secret)
+		}
+	}
+
+	// What helps debugging a flow is kept.
+	kept := []string{"Jane Doe", "application/json", "lang=", "https://example.com/invoice.pdf", "obtainKrakenToken"}
+
+	for _, value := range kept {
+		if !strings.Contains(har, value) {
+			t.Errorf("HAR lost %q", value)
+		}
+	}
+
+	var parsed struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					URL string `json:"url"`
+				} `json:"request"`
+				Response struct {
+					Content map[string]any `json:"content"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+
+	if err := json.Unmarshal(content, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	const wantURL = "https://api.example.com/graphql?idt=[redacted]&lang=[redacted]#[redacted]"
+	if got := parsed.Log.Entries[0].Request.URL; got != wantURL {
+		t.Errorf("got URL %q, want %q", got, wantURL)
+	}
+
+	for i, entry := range parsed.Log.Entries[1:] {
+		if _, ok := entry.Response.Content["text"]; ok {
+			t.Errorf("entry %d kept its %s body", i+1, entry.Response.Content["mimeType"])
+		}
+
+		if _, ok := entry.Response.Content["encoding"]; ok {
+			t.Errorf("entry %d kept its encoding", i+1)
+		}
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("got mode %v, %v, want %v", info.Mode().Perm(), err, os.FileMode(0o600))
+	}
+}
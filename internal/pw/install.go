@@ -0,0 +1,107 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"github.com/playwright-community/playwright-go"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrBrowserMissing = errors.New("browser not installed")
+
+// InstallOptions configure Install and Doctor.
+type InstallOptions struct {
+	// DriverDirectory holds the playwright driver, defaults to the playwright-go cache directory.
+	DriverDirectory string
+	Browsers        []Browser
+	Stdout          io.Writer
+	Stderr          io.Writer
+}
+
+func (o InstallOptions) runOptions() *playwright.RunOptions {
+	names := make([]string, 0, len(o.Browsers))
+	for _, browser := range o.Browsers {
+		names = append(names, browser.String())
+	}
+
+	return &playwright.RunOptions{
+		DriverDirectory: o.DriverDirectory,
+		Browsers:        names,
+		Stdout:          o.Stdout,
+		Stderr:          o.Stderr,
+	}
+}
+
+// Install downloads the playwright driver and the browsers listed in opts.
+func Install(opts InstallOptions) error {
+	if err := playwright.Install(opts.runOptions()); err != nil {
+		return fmt.Errorf("installing playwright: %w", err)
+	}
+
+	return nil
+}
+
+// Check is the outcome of a single Doctor check.
+type Check struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// Doctor checks that the playwright driver and the browsers listed in opts are installed, without installing anything.
+func Doctor(opts InstallOptions) []Check {
+	runOptions := opts.runOptions()
+
+	driver, err := playwright.NewDriver(runOptions)
+	if err != nil {
+		return []Check{{Name: "driver", Err: err}}
+	}
+
+	driverCheck := Check{Name: "driver", Detail: runOptions.DriverDirectory}
+
+	output, err := driver.Command("--version").Output()
+	if err != nil {
+		driverCheck.Err = fmt.Errorf("running driver in %s: %w", runOptions.DriverDirectory, err)
+		return []Check{driverCheck}
+	}
+
+	if version := strings.TrimSpace(string(output)); !strings.Contains(version, driver.Version) {
+		driverCheck.Err = fmt.Errorf("driver version is %q, expected %s", version, driver.Version)
+		return []Check{driverCheck}
+	}
+
+	driverCheck.Detail = fmt.Sprintf("version %s in %s", driver.Version, runOptions.DriverDirectory)
+	checks := []Check{driverCheck}
+
+	playw, err := playwright.Run(runOptions)
+	if err != nil {
+		return append(checks, Check{Name: "driver", Err: fmt.Errorf("launching playwright: %w", err)})
+	}
+
+	defer playw.Stop() //nolint:errcheck
+
+	for _, browser := range opts.Browsers {
+		check := Check{Name: browser.String(), Detail: browserType(playw, browser).ExecutablePath()}
+
+		if _, err := os.Stat(check.Detail); err != nil {
+			check.Err = fmt.Errorf("%w: %w", ErrBrowserMissing, err)
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+func browserType(playw *playwright.Playwright, browser Browser) playwright.BrowserType {
+	switch browser {
+	case BrowserChromium:
+		return playw.Chromium
+	case BrowserFirefox:
+		return playw.Firefox
+	default:
+		return playw.Firefox
+	}
+}
@@ -0,0 +1,183 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/playwright-community/playwright-go"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoDocument   = fmt.Errorf("%w for period", errs.ErrNoDocument)
+	ErrEmptyListing = fmt.Errorf("%w listed", errs.ErrNoDocument)
+)
+
+// Listing describes the documents listed on a page, latest first, each with its own download button.
+type Listing struct {
+	// Buttons matches the download button of every document.
+	Buttons playwright.Locator
+	// Next is clicked to go to the next page of documents, until it is hidden or disabled.
+	// The listing has a single page when nil.
+	Next playwright.Locator
+	// Date returns the date of the document of button. Documents are not dated when nil.
+	Date func(button playwright.Locator) (time.Time, error)
+	// Keep reports whether the document dated date is selected. Every document is when nil.
+	// Documents are selected by date, failing to date one is an error when Keep is set.
+	Keep func(date time.Time) bool
+}
+
+// DownloadFirst downloads the first document of listing selected by Keep, unless it was already saved.
+// It returns whether it saved it.
+func DownloadFirst(page playwright.Page, out Output, listing Listing) (bool, error) {
+	found, saved := false, false
+
+	err := listing.each(page, func(button playwright.Locator, date time.Time) (bool, error) {
+		found = true
+
+		var err error
+		saved, err = download(page, out, func() error { return button.Click() }, date, true)
+
+		return false, err
+	})
+	if err != nil {
+		return saved, err
+	}
+
+	if !found {
+		return false, ErrNoDocument
+	}
+
+	return saved, nil
+}
+
+// DownloadEach downloads every document of listing selected by Keep, skipping those already saved.
+// It returns the number of documents saved.
+func DownloadEach(page playwright.Page, out Output, listing Listing) (int, error) {
+	found, saved := 0, 0
+
+	err := listing.each(page, func(button playwright.Locator, date time.Time) (bool, error) {
+		found++
+
+		ok, err := download(page, out, func() error { return button.Click() }, date, true)
+		if ok {
+			saved++
+		}
+
+		return true, err
+	})
+	if err != nil {
+		return saved, err
+	}
+
+	if found == 0 {
+		return 0, ErrNoDocument
+	}
+
+	return saved, nil
+}
+
+// each calls fn with the button and date of every document selected by Keep, going through pages,
+// until fn returns false.
+func (l Listing) each(page playwright.Page, fn func(button playwright.Locator, date time.Time) (bool, error)) error {
+	for pageNum := 1; ; pageNum++ {
+		err := l.Buttons.First().WaitFor()
+
+		// The first page may hold no document yet, while later ones were announced by the next button.
+		switch {
+		case errors.Is(err, playwright.ErrTimeout) && pageNum == 1:
+			return fmt.Errorf("%w: waiting for documents: %w", ErrEmptyListing, err)
+		case errors.Is(err, playwright.ErrTimeout):
+			return fmt.Errorf("%w: waiting for documents of page %d: %w", errs.ErrSiteUnavailable, pageNum, err)
+		case err != nil:
+			return fmt.Errorf("waiting for documents of page %d: %w", pageNum, err)
+		}
+
+		buttons, err := l.Buttons.All()
+		if err != nil {
+			return fmt.Errorf("listing documents of page %d: %w", pageNum, err)
+		}
+
+		for i, button := range buttons {
+			var date time.Time
+
+			if l.Date != nil {
+				date, err = l.Date(button)
+				if err != nil && l.Keep != nil {
+					return fmt.Errorf("dating document %d of page %d: %w", i+1, pageNum, err)
+				}
+			}
+
+			if l.Keep != nil && !l.Keep(date) {
+				continue
+			}
+
+			more, err := fn(button, date)
+			if err != nil {
+				return fmt.Errorf("downloading document %d of page %d: %w", i+1, pageNum, err)
+			}
+
+			if !more {
+				return nil
+			}
+		}
+
+		if l.Next == nil {
+			return nil
+		}
+
+		if visible, _ := l.Next.IsVisible(); !visible {
+			return nil
+		}
+
+		if enabled, _ := l.Next.IsEnabled(); !enabled {
+			return nil
+		}
+
+		// Sites paginating client-side do not load a new page, wait for the rows to change instead.
+		first := rowOf(l.Buttons.First())
+		previous, rowErr := RowText(l.Buttons.First())
+
+		if err := l.Next.Click(); err != nil {
+			return fmt.Errorf("going to page %d: %w", pageNum+1, err)
+		}
+
+		if err := page.WaitForLoadState(); err != nil {
+			return fmt.Errorf("waiting for page %d: %w", pageNum+1, err)
+		}
+
+		if rowErr == nil {
+			err := playwright.NewPlaywrightAssertions().Locator(first).Not().ToHaveText(previous,
+				playwright.LocatorAssertionsToHaveTextOptions{
+					Timeout:      playwright.Float(30000),
+					UseInnerText: playwright.Bool(true),
+				})
+			if errors.Is(err, playwright.ErrTimeout) {
+				return fmt.Errorf("%w: waiting for documents of page %d: %w", errs.ErrSiteUnavailable, pageNum+1, err)
+			}
+
+			if err != nil {
+				return fmt.Errorf("waiting for documents of page %d: %w", pageNum+1, err)
+			}
+		}
+	}
+}
+
+// rowOf returns the table row or list item holding button.
+func rowOf(button playwright.Locator) playwright.Locator {
+	return button.Locator("xpath=ancestor::*[self::tr or self::li][1]")
+}
+
+// RowText returns the text of the table row or list item holding button, where sites show the document date.
+func RowText(button playwright.Locator) (string, error) {
+	// The row is there as soon as the button is, do not wait for buttons outside of a row.
+	text, err := rowOf(button).InnerText(playwright.LocatorInnerTextOptions{
+		Timeout: playwright.Float(1000),
+	})
+	if err != nil {
+		return "", fmt.Errorf("reading document row: %w", err)
+	}
+
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,58 @@
+package pw
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// discard is the logger of runs that have none.
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// orDiscard returns logger, or a logger discarding every record when nil.
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discard
+	}
+
+	return logger
+}
+
+// LogWriter returns a writer logging every line written to it with msg at level, the line in a "line" attribute.
+// It routes the output of the playwright driver through logger.
+func LogWriter(logger *slog.Logger, level slog.Level, msg string) io.Writer {
+	return &logWriter{logger: orDiscard(logger), level: level, msg: msg}
+}
+
+type logWriter struct {
+	logger *slog.Logger
+	level  slog.Level
+	msg    string
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+// Write logs the complete lines of p, keeping the last one until it is complete.
+// Carriage returns end lines too, progress bars use them.
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, p...)
+
+	for {
+		end := bytes.IndexAny(w.pending, "\r\n")
+		if end < 0 {
+			return len(p), nil
+		}
+
+		if line := bytes.TrimSpace(w.pending[:end]); len(line) > 0 {
+			w.logger.Log(context.Background(), w.level, w.msg, "line", string(line))
+		}
+
+		w.pending = w.pending[end+1:]
+	}
+}
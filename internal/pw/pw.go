@@ -2,12 +2,17 @@
 package pw
 
 import (
-	"encoding/json"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
 	"github.com/playwright-community/playwright-go"
-	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Browser int
@@ -17,40 +22,112 @@ const (
 	BrowserFirefox
 )
 
-const cookieFileName = "cookies.json"
+var ErrUnknownBrowser = errors.New("unknown browser")
+
+func (b Browser) String() string {
+	switch b {
+	case BrowserChromium:
+		return "chromium"
+	case BrowserFirefox:
+		return "firefox"
+	default:
+		return fmt.Sprintf("Browser(%d)", int(b))
+	}
+}
+
+// ParseBrowser returns the browser named name, as returned by Browser.String.
+func ParseBrowser(name string) (Browser, error) {
+	switch name {
+	case "chromium":
+		return BrowserChromium, nil
+	case "firefox":
+		return BrowserFirefox, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownBrowser, name)
+	}
+}
+
+// Options configure Run.
+type Options struct {
+	// Logger logs the steps of the run and the output of the playwright driver. Nothing is logged when nil.
+	Logger   *slog.Logger
+	Headless bool
+	Browser  Browser
+	// SessionFile is where the storage state (cookies and local storage) is loaded from and saved to.
+	// Sessions are not persisted when empty.
+	SessionFile string
+	// SessionCipher encrypts the session file. It is stored in clear text when nil.
+	SessionCipher *SessionCipher
+	// DriverDirectory holds the playwright driver, defaults to the playwright-go cache directory.
+	DriverDirectory string
+	// Report collects warnings, also logged.
+	Report *Report
+	// Artifacts configures the bundle saved when callback fails.
+	Artifacts Artifacts
+	// Trace records a playwright trace of the run, added to the failure bundle and discarded on success.
+	Trace bool
+	// RecordHAR saves the network exchanges of the run to its bundle, see Artifacts, whether it fails or not.
+	RecordHAR bool
+	// Video records a video of the run, kept in its bundle according to the policy. No video is recorded when empty.
+	Video Video
+	// VideoMaxSize is the size in bytes over which videos are discarded, unlimited when not positive.
+	VideoMaxSize int64
+	// Secrets are the credential values scrubbed from the HAR.
+	Secrets []string
+}
+
+// Session persists the browser session of a run.
+type Session struct {
+	browserContext playwright.BrowserContext
+	file           string
+	cipher         *SessionCipher
+}
+
+// Save saves the session now. Callbacks call it once logged in, so that the session is kept
+// even if the rest of the run fails or is cancelled. It does nothing when sessions are not persisted.
+func (s *Session) Save() error {
+	if s.file == "" {
+		return nil
+	}
+
+	if err := saveStorageState(s.browserContext, s.file, s.cipher); err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+
+	return nil
+}
 
 // Run runs callback in a playwright context, handling resource (de)allocation.
-func Run(stdout, stderr io.Writer, headless bool, brwsr Browser, callback func(playwright.Page) error) error {
-	options := &playwright.RunOptions{
-		Browsers: []string{"firefox", "chromium"},
-		Stdout:   stdout,
-		Stderr:   stderr,
+// When ctx is done, the browser is closed, which makes pending playwright calls of callback fail.
+func Run(ctx context.Context, opts Options, callback func(playwright.Page, *Session) error) error {
+	logger := orDiscard(opts.Logger)
+
+	installOptions := InstallOptions{
+		DriverDirectory: opts.DriverDirectory,
+		Browsers:        []Browser{opts.Browser},
+		Stdout:          LogWriter(logger, slog.LevelInfo, "playwright"),
+		Stderr:          LogWriter(logger, slog.LevelWarn, "playwright"),
 	}
-	err := playwright.Install(options)
-	if err != nil {
-		return fmt.Errorf("installing playwright: %w", err)
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	playw, err := playwright.Run(options)
+	playw, err := playwright.Run(installOptions.runOptions())
 	if err != nil {
-		return fmt.Errorf("launching playwright: %w", err)
+		return fmt.Errorf("launching playwright, run the install command first: %w", err)
 	}
 
 	defer playw.Stop() //nolint:errcheck
 
-	var browserType playwright.BrowserType
-
-	switch brwsr {
-	case BrowserChromium:
-		browserType = playw.Chromium
-	case BrowserFirefox:
-		browserType = playw.Firefox
-	default:
-		browserType = playw.Firefox
+	// Runs never install anything, the install command does.
+	browserType := browserType(playw, opts.Browser)
+	if _, err := os.Stat(browserType.ExecutablePath()); err != nil {
+		return fmt.Errorf("%w: %s, run the install command first: %w", ErrBrowserMissing, opts.Browser, err)
 	}
 
 	browser, err := browserType.Launch(playwright.BrowserTypeLaunchOptions{
-		Headless: playwright.Bool(headless),
+		Headless: playwright.Bool(opts.Headless),
 	})
 	if err != nil {
 		return fmt.Errorf("launching browser: %w", err)
@@ -58,111 +135,172 @@ func Run(stdout, stderr io.Writer, headless bool, brwsr Browser, callback func(p
 
 	defer browser.Close()
 
-	context, err := browser.NewContext(playwright.BrowserNewContextOptions{})
-	if err != nil {
-		return fmt.Errorf("creating context: %w", err)
-	}
+	stop := context.AfterFunc(ctx, func() { _ = browser.Close() })
+	defer stop()
 
-	defer context.Close()
+	bundle := opts.Artifacts.bundle(time.Now())
+	contextOptions := playwright.BrowserNewContextOptions{}
 
-	if err := loadCookies(context, cookieFileName); err != nil {
-		_, _ = fmt.Fprintf(stderr, "failed to load cookies, continuing anyway: %v\n", err)
-	}
+	if opts.SessionFile != "" {
+		state, err := loadStorageState(opts.SessionFile, opts.SessionCipher)
 
-	page, err := context.NewPage()
-	if err != nil {
-		return fmt.Errorf("creating page: %w", err)
-	}
+		// Saving would overwrite a session that may still be readable with the right key.
+		if errors.Is(err, ErrWrongSessionKey) || errors.Is(err, ErrEncryptedSession) {
+			return fmt.Errorf("loading session: %w", err)
+		}
 
-	defer page.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn("failed to load session, continuing anyway", "error", err)
+			opts.Report.Warn("failed to load session: %v", err)
+		}
 
-	if err := callback(page); err != nil {
-		saveScreenshot(page, "screenshots")
-		return err
+		contextOptions.StorageState = state
 	}
 
-	if err := saveCookies(context, cookieFileName); err != nil {
-		return fmt.Errorf("saving cookies: %w", err)
+	rec, err := newRecorder(opts, bundle, &contextOptions)
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	defer rec.close()
 
-func saveCookies(context playwright.BrowserContext, filename string) error {
-	cookies, err := context.Cookies()
+	browserContext, err := browser.NewContext(contextOptions)
 	if err != nil {
-		return fmt.Errorf("getting cookies: %w", err)
+		return fmt.Errorf("creating context: %w", err)
 	}
 
-	optCookies := make([]playwright.OptionalCookie, 0, len(cookies))
+	failed := false
 
-	for _, cookie := range cookies {
-		optCookies = append(optCookies, cookie.ToOptionalCookie())
-	}
+	defer func() {
+		// Recordings are written when the context is closed.
+		_ = browserContext.Close()
 
-	asJSON, err := json.Marshal(optCookies)
-	if err != nil {
-		return fmt.Errorf("marshaling cookies: %w", err)
+		// The browser was killed, recordings are incomplete.
+		if ctx.Err() != nil {
+			return
+		}
+
+		saved, err := rec.save(opts, failed)
+		if err != nil {
+			logger.Warn("failed to save recordings", "error", err)
+			opts.Report.Warn("failed to save recordings: %v", err)
+		}
+
+		if saved {
+			logger.Info("recordings saved", "dir", bundle)
+			opts.Report.artifacts(bundle)
+		}
+
+		if err := opts.Artifacts.prune(); err != nil {
+			logger.Warn("failed to prune artifacts", "error", err)
+			opts.Report.Warn("%v", err)
+		}
+	}()
+
+	var tracing playwright.Tracing
+
+	if opts.Trace {
+		tracing = browserContext.Tracing()
+
+		err := tracing.Start(playwright.TracingStartOptions{
+			Screenshots: playwright.Bool(true),
+			Snapshots:   playwright.Bool(true),
+			Sources:     playwright.Bool(true),
+		})
+		if err != nil {
+			return fmt.Errorf("starting trace: %w", err)
+		}
 	}
 
-	file, err := os.Create(filename)
+	page, err := browserContext.NewPage()
 	if err != nil {
-		return fmt.Errorf("creating %s: %w", filename, err)
+		return fmt.Errorf("creating page: %w", err)
 	}
 
-	defer file.Close()
+	defer page.Close()
 
-	if _, err := file.Write(asJSON); err != nil {
-		return fmt.Errorf("writing cookies.json: %w", err)
-	}
+	rec.watch(page)
+	messages := watchConsole(page)
 
-	return nil
-}
+	page.OnFrameNavigated(func(frame playwright.Frame) {
+		if frame == page.MainFrame() {
+			logger.Debug("navigated", "url", frame.URL())
+		}
+	})
 
-func loadCookies(context playwright.BrowserContext, filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("opening %s: %w", filename, err)
-	}
+	session := &Session{browserContext: browserContext, file: opts.SessionFile, cipher: opts.SessionCipher}
 
-	defer file.Close()
+	if err := callback(page, session); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("%w: %w", ctxErr, err)
+		}
 
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
-		return fmt.Errorf("reading %s: %w", filename, err)
-	}
+		failed = true
+
+		if saveErr := opts.Artifacts.save(bundle, page, err, messages, tracing); saveErr != nil {
+			logger.Warn("failed to save failure artifacts", "error", saveErr)
+			opts.Report.Warn("failed to save failure artifacts: %v", saveErr)
+		}
+
+		if bundle != "" {
+			logger.Info("failure artifacts saved", "dir", bundle)
+			opts.Report.artifacts(bundle)
+		}
 
-	var cookies []playwright.OptionalCookie
-	if err := json.Unmarshal(fileContent, &cookies); err != nil {
-		return fmt.Errorf("unmarshaling cookies: %w", err)
+		return classify(err)
 	}
 
-	if err := context.AddCookies(cookies); err != nil {
-		return fmt.Errorf("adding cookies: %w", err)
+	if tracing != nil {
+		// Discards the trace.
+		_ = tracing.Stop()
 	}
 
-	return nil
+	return session.Save()
 }
 
-func saveScreenshot(page playwright.Page, dir string) {
-	img, err := page.Screenshot()
-	if err != nil {
-		return
-	}
+// Output is where downloaded documents are saved.
+type Output struct {
+	Dir string
+	// Manifest records saved documents, so that they are only saved once. Nothing is recorded when nil.
+	Manifest *manifest.Scope
+	// Name returns the path of a document relative to Dir, from the file name suggested by the site
+	// and the document date, zero when unknown. Documents keep the suggested name, sanitised, when nil.
+	Name func(suggested string, date time.Time) string
+	// Collision applies when a file already exists under the name of a document. Defaults to CollisionCompareHash.
+	Collision Collision
+	// Sidecar holds the metadata shared by the documents, completed and written next to each of them.
+	// No sidecar is written when nil.
+	Sidecar *Sidecar
+	// Report collects the documents saved and skipped. Nothing is collected when nil.
+	Report *Report
+	// Pages is the expected page count of PDF documents, not checked when zero.
+	Pages int
+	// Quarantine is where PDF documents failing validation are kept for inspection. They are discarded when empty.
+	Quarantine string
+	// Logger logs the documents saved and skipped. Nothing is logged when nil.
+	Logger *slog.Logger
+}
 
-	const perm = 0o755
-	_ = os.MkdirAll(dir, perm)
+func (o Output) save(doc Document) {
+	orDiscard(o.Logger).Info("saved document", "path", doc.Path, "file", doc.OriginalFilename, "date", doc.Date)
+	o.Report.save(doc)
+}
 
-	file, err := os.Create(filepath.Join(dir, "screenshot.png"))
-	if err != nil {
-		return
+func (o Output) skip(doc Document, reason string) {
+	orDiscard(o.Logger).Info("skipped document", "file", doc.OriginalFilename, "reason", reason)
+	o.Report.skip(doc, reason)
+}
+
+// path returns where to save the document suggested as suggested and dated date.
+func (o Output) path(suggested string, date time.Time) (string, error) {
+	if o.Name == nil {
+		return safePath(o.Dir, sanitiseName(suggested))
 	}
 
-	defer file.Close()
-	_, _ = file.Write(img)
+	return safePath(o.Dir, o.Name(suggested, date))
 }
 
-func DownloadPDFPopup(page playwright.Page, outputDir, url, filename string, triggerPopup func() error) error {
+func DownloadPDFPopup(page playwright.Page, out Output, url, filename string, triggerPopup func() error) error {
 	err := page.Context().Route(url, func(route playwright.Route) {
 		resp, err := route.Fetch()
 		if err != nil {
@@ -185,22 +323,178 @@ func DownloadPDFPopup(page playwright.Page, outputDir, url, filename string, tri
 		return fmt.Errorf("opening popup: %w", err)
 	}
 
-	if err := Download(popup, outputDir, func() error { return nil }); err != nil {
+	if err := Download(popup, out, func() error { return nil }); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func Download(page playwright.Page, outputDir string, trigger func() error) error {
+// Download saves the file downloaded by trigger, unless the manifest holds a document with the same content.
+func Download(page playwright.Page, out Output, trigger func() error) error {
+	_, err := download(page, out, trigger, time.Time{}, false)
+	return err
+}
+
+// validate checks the PDF document doc, downloaded at tmpPath to be saved at path, and quarantines it if invalid.
+func (o Output) validate(tmpPath, path string, doc Document) error {
+	pages, err := validatePDF(tmpPath, o.Pages)
+	if err == nil {
+		if o.Pages > 0 && pages == 0 {
+			orDiscard(o.Logger).Warn("could not count the pages", "file", doc.OriginalFilename)
+			o.Report.Warn("could not count the pages of %s", doc.OriginalFilename)
+		}
+
+		return nil
+	}
+
+	quarantined, qErr := quarantine(tmpPath, o.Quarantine, path)
+	if qErr != nil {
+		return errors.Join(fmt.Errorf("%s: %w", doc.OriginalFilename, err), qErr)
+	}
+
+	doc.Path = quarantined
+	o.skip(doc, err.Error())
+
+	if quarantined == "" {
+		return fmt.Errorf("%s: %w", doc.OriginalFilename, err)
+	}
+
+	return fmt.Errorf("%s, quarantined as %s: %w", doc.OriginalFilename, quarantined, err)
+}
+
+// download saves the file downloaded by trigger in out, dated date if not zero, and returns whether it did.
+// When skipSeen is set and date is not zero, the download is cancelled if the manifest already holds a document with
+// the same name and date.
+// Documents with the same content as one in the manifest are never saved twice.
+func download(page playwright.Page, out Output, trigger func() error, date time.Time, skipSeen bool) (bool, error) {
 	download, err := page.ExpectDownload(trigger)
+	if errors.Is(err, playwright.ErrTimeout) {
+		// The button was there, the site is too slow to serve the file.
+		return false, fmt.Errorf("%w: downloading file: %w", errs.ErrSiteUnavailable, err)
+	}
+
 	if err != nil {
-		return fmt.Errorf("downloading file: %w", err)
+		return false, fmt.Errorf("downloading file: %w", err)
 	}
 
-	if err := download.SaveAs(outputDir + "/" + download.SuggestedFilename()); err != nil {
-		return fmt.Errorf("saving file: %w", err)
+	id := download.SuggestedFilename()
+	orDiscard(out.Logger).Debug("downloading", "file", id, "url", stripURL(download.URL()))
+	doc := Document{OriginalFilename: id}
+
+	if !date.IsZero() {
+		doc.Date = date.Format(time.DateOnly)
 	}
 
-	return nil
+	path, err := out.path(id, date)
+	if err != nil {
+		_ = download.Cancel()
+		return false, err
+	}
+
+	if skipSeen && out.Manifest.HasDocument(id, doc.Date) {
+		_ = download.Cancel()
+		out.skip(doc, "already in the manifest")
+
+		return false, nil
+	}
+
+	collision := cmp.Or(out.Collision, CollisionCompareHash)
+
+	if _, err := os.Stat(path); collision == CollisionSkip && err == nil {
+		_ = download.Cancel()
+		doc.Path = path
+		out.skip(doc, "file already exists")
+
+		return false, nil
+	}
+
+	const perm = 0o755
+	if err := os.MkdirAll(filepath.Dir(path), perm); err != nil {
+		_ = download.Cancel()
+		return false, fmt.Errorf("creating directory: %w", err)
+	}
+
+	// Save under a temporary name so that an interrupted run never leaves a truncated document.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		_ = download.Cancel()
+		return false, fmt.Errorf("saving file: %w", err)
+	}
+
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
+
+	defer os.Remove(tmpPath)
+
+	if err := download.SaveAs(tmpPath); err != nil {
+		return false, fmt.Errorf("saving file: %w", err)
+	}
+
+	if err := syncFile(tmpPath); err != nil {
+		return false, err
+	}
+
+	if isPDF(path, id) {
+		if err := out.validate(tmpPath, path, doc); err != nil {
+			return false, err
+		}
+	}
+
+	if doc.SHA256, err = manifest.FileSum(tmpPath); err != nil {
+		return false, err
+	}
+
+	if out.Manifest.HasSum(doc.SHA256) {
+		out.skip(doc, "same content as a document in the manifest")
+		return false, nil
+	}
+
+	saved, err := place(tmpPath, path, doc.SHA256, collision)
+	if err != nil {
+		return false, err
+	}
+
+	if saved == "" {
+		doc.Path = path
+		out.skip(doc, "file already exists")
+
+		return false, nil
+	}
+
+	doc.Path = saved
+
+	// Persist the new directory entry.
+	if err := syncFile(filepath.Dir(saved)); err != nil {
+		return true, err
+	}
+
+	name, err := filepath.Rel(out.Dir, saved)
+	if err != nil {
+		return true, fmt.Errorf("recording %s: %w", saved, err)
+	}
+
+	now := time.Now()
+
+	if out.Sidecar != nil {
+		sidecar := *out.Sidecar
+		sidecar.Date = doc.Date
+		sidecar.DownloadedAt = now
+		sidecar.URL = stripURL(download.URL())
+		sidecar.OriginalFilename = id
+		sidecar.SHA256 = doc.SHA256
+
+		if err := sidecar.write(saved); err != nil {
+			return true, err
+		}
+	}
+
+	out.save(doc)
+
+	entry := manifest.Entry{ID: id, Date: doc.Date, Path: filepath.ToSlash(name), SHA256: doc.SHA256, SavedAt: now}
+	if err := out.Manifest.Add(entry); err != nil {
+		return true, fmt.Errorf("recording %s: %w", name, err)
+	}
+
+	return true, nil
 }
@@ -0,0 +1,158 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"github.com/playwright-community/playwright-go"
+	"os"
+	"path/filepath"
+)
+
+var ErrUnknownVideo = errors.New("unknown video policy")
+
+// Video is when the video of a run is kept.
+type Video string
+
+const (
+	// VideoNever does not record videos.
+	VideoNever Video = "never"
+	// VideoOnFailure keeps the video of failed runs only.
+	VideoOnFailure Video = "on-failure"
+	// VideoAlways keeps the video of every run.
+	VideoAlways Video = "always"
+)
+
+// Videos lists the video policies.
+var Videos = []Video{VideoNever, VideoOnFailure, VideoAlways}
+
+// ParseVideo returns the video policy named name.
+func ParseVideo(name string) (Video, error) {
+	for _, video := range Videos {
+		if string(video) == name {
+			return video, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownVideo, name)
+}
+
+// recorder captures the HAR and the video of a run, saved to its bundle once the browser context is closed.
+type recorder struct {
+	bundle   string
+	rawHAR   string
+	videoDir string
+	video    playwright.Video
+}
+
+// newRecorder sets contextOptions up to record what opts ask for, to be saved in bundle. It records nothing
+// when bundle is empty. The returned recorder must be closed.
+func newRecorder(opts Options, bundle string, contextOptions *playwright.BrowserNewContextOptions) (*recorder, error) {
+	r := &recorder{bundle: bundle}
+
+	if bundle == "" {
+		return r, nil
+	}
+
+	if opts.RecordHAR {
+		// The HAR is only written to the bundle once scrubbed.
+		dir, err := os.MkdirTemp("", "downloader-har-*")
+		if err != nil {
+			return nil, fmt.Errorf("recording HAR: %w", err)
+		}
+
+		r.rawHAR = filepath.Join(dir, "network.har")
+		contextOptions.RecordHarPath = &r.rawHAR
+		contextOptions.RecordHarContent = playwright.HarContentPolicyEmbed
+	}
+
+	if opts.Video == VideoOnFailure || opts.Video == VideoAlways {
+		dir, err := os.MkdirTemp("", "downloader-video-*")
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("recording video: %w", err)
+		}
+
+		r.videoDir = dir
+		contextOptions.RecordVideo = &playwright.RecordVideo{Dir: dir}
+	}
+
+	return r, nil
+}
+
+// watch records the video of page.
+func (r *recorder) watch(page playwright.Page) {
+	if r.videoDir != "" {
+		r.video = page.Video()
+	}
+}
+
+// save saves the HAR and the video to the bundle, once the browser context is closed, and returns whether it saved
+// anything. The video is only kept if the run failed or opts ask for it, and if it is not larger than
+// opts.VideoMaxSize.
+func (r *recorder) save(opts Options, failed bool) (bool, error) {
+	saved := false
+
+	var problems []error
+
+	if r.rawHAR != "" {
+		if err := saveHAR(r.rawHAR, filepath.Join(r.bundle, "network.har"), opts.Secrets); err != nil {
+			problems = append(problems, err)
+		} else {
+			saved = true
+		}
+	}
+
+	if r.video != nil && (failed || opts.Video == VideoAlways) {
+		ok, err := r.saveVideo(filepath.Join(r.bundle, "video.webm"), opts.VideoMaxSize)
+		saved = saved || ok
+
+		problems = append(problems, err)
+	}
+
+	return saved, errors.Join(problems...)
+}
+
+// saveVideo saves the video to path unless it is larger than maxSize, in bytes, if positive,
+// and returns whether it did.
+func (r *recorder) saveVideo(path string, maxSize int64) (bool, error) {
+	recorded, err := r.video.Path()
+	if err != nil {
+		return false, fmt.Errorf("saving video: %w", err)
+	}
+
+	info, err := os.Stat(recorded)
+	if err != nil {
+		return false, fmt.Errorf("saving video: %w", err)
+	}
+
+	if maxSize > 0 && info.Size() > maxSize {
+		return false, fmt.Errorf("video of %d bytes discarded, larger than %d bytes", info.Size(), maxSize)
+	}
+
+	const dirPerm = 0o700
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return false, fmt.Errorf("saving video: %w", err)
+	}
+
+	if err := r.video.SaveAs(path); err != nil {
+		return false, fmt.Errorf("saving video: %w", err)
+	}
+
+	const filePerm = 0o600
+	if err := os.Chmod(path, filePerm); err != nil {
+		return true, fmt.Errorf("saving video: %w", err)
+	}
+
+	return true, nil
+}
+
+// close deletes the raw recordings.
+func (r *recorder) close() {
+	if r.rawHAR != "" {
+		_ = os.RemoveAll(filepath.Dir(r.rawHAR))
+	}
+
+	if r.videoDir != "" {
+		_ = os.RemoveAll(r.videoDir)
+	}
+}
@@ -0,0 +1,67 @@
+package pw
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Document is a document saved or skipped by a download helper.
+type Document struct {
+	// Path is where the document was saved, or the file that made it skipped. It is empty when there is none.
+	Path             string `json:"path,omitempty"`
+	OriginalFilename string `json:"original_filename"`
+	// Date is the date of the document as listed by the provider, formatted as 2006-01-02. It is empty when unknown.
+	Date   string `json:"date,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Reason tells why a document was skipped.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Report collects the documents saved and skipped during a run, along with warnings.
+type Report struct {
+	Saved    []Document `json:"saved"`
+	Skipped  []Document `json:"skipped"`
+	Warnings []string   `json:"warnings"`
+	// Artifacts is the directory of the bundle of the run, saved when it failed or a HAR was recorded, see Artifacts.
+	Artifacts string `json:"artifacts,omitempty"`
+}
+
+func (r *Report) save(doc Document) {
+	if r != nil {
+		doc.Path = absPath(doc.Path)
+		r.Saved = append(r.Saved, doc)
+	}
+}
+
+func (r *Report) skip(doc Document, reason string) {
+	if r != nil {
+		doc.Path = absPath(doc.Path)
+		doc.Reason = reason
+		r.Skipped = append(r.Skipped, doc)
+	}
+}
+
+func (r *Report) artifacts(dir string) {
+	if r != nil {
+		r.Artifacts = absPath(dir)
+	}
+}
+
+// Warn records a warning.
+func (r *Report) Warn(format string, args ...any) {
+	if r != nil {
+		r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+	}
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
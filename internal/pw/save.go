@@ -0,0 +1,173 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
+	"github.com/Crocmagnon/downloader-go/internal/naming"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsafeName       = errors.New("unsafe file name")
+	ErrUnknownCollision = errors.New("unknown collision policy")
+)
+
+// Collision is what to do when a document is saved under the name of an existing file.
+type Collision string
+
+const (
+	// CollisionSkip keeps the existing file and does not download the document.
+	CollisionSkip Collision = "skip"
+	// CollisionOverwrite replaces the existing file.
+	CollisionOverwrite Collision = "overwrite"
+	// CollisionSuffix saves the document under a free name, e.g. invoice (1).pdf.
+	CollisionSuffix Collision = "suffix"
+	// CollisionCompareHash keeps the existing file if it has the same content, otherwise behaves like CollisionSuffix.
+	CollisionCompareHash Collision = "compare-hash"
+)
+
+// Collisions lists the collision policies.
+var Collisions = []Collision{CollisionSkip, CollisionOverwrite, CollisionSuffix, CollisionCompareHash}
+
+// ParseCollision returns the collision policy named name.
+func ParseCollision(name string) (Collision, error) {
+	for _, collision := range Collisions {
+		if string(collision) == name {
+			return collision, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownCollision, name)
+}
+
+// safePath returns the path of name in dir, refusing names leading outside of dir or naming dir itself.
+func safePath(dir, name string) (string, error) {
+	name = filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsLocal(name) || name == "." {
+		return "", fmt.Errorf("%w: %q", ErrUnsafeName, name)
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// sanitiseName returns a file name safe to save a document suggested as name under.
+func sanitiseName(name string) string {
+	if name = naming.Sanitise(name); name == "" {
+		return "document"
+	}
+
+	return name
+}
+
+// place moves the complete file at tmpPath to path according to collision, and returns where the file was saved,
+// or an empty string when it was not. The caller removes tmpPath. The file is never moved over another one unless collision is
+// CollisionOverwrite, even if a file appears at path meanwhile.
+func place(tmpPath, path, sum string, collision Collision) (string, error) {
+	if collision == CollisionOverwrite {
+		if err := os.Rename(tmpPath, path); err != nil {
+			return "", fmt.Errorf("saving file: %w", err)
+		}
+
+		return path, nil
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	for i := 0; ; i++ {
+		candidate := path
+		if i > 0 {
+			candidate = base + " (" + strconv.Itoa(i) + ")" + ext
+		}
+
+		err := createExclusive(tmpPath, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("saving file: %w", err)
+		}
+
+		switch collision {
+		case CollisionSkip:
+			return "", nil
+		case CollisionCompareHash:
+			existing, err := manifest.FileSum(candidate)
+			if err != nil {
+				return "", err
+			}
+
+			if existing == sum {
+				return "", nil
+			}
+		case CollisionSuffix, CollisionOverwrite:
+		}
+	}
+}
+
+// link is os.Link, replaced in tests to exercise the copy fallback of createExclusive.
+var link = os.Link
+
+// createExclusive creates path with the content of the file at tmpPath, failing with os.ErrExist when path exists.
+// It links the file, unlike renaming linking fails when path exists, and falls back to copying it on file systems
+// without hard links, such as vfat, exFAT or SMB mounts.
+func createExclusive(tmpPath, path string) error {
+	err := link(tmpPath, path)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	src, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+	}
+
+	return err
+}
+
+// syncFile flushes the file at path to disk.
+func syncFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("syncing %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("syncing %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package pw
+
+import (
+	"errors"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSafePath(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := map[string]string{
+		"invoice.pdf":         filepath.Join(dir, "invoice.pdf"),
+		"freebox/invoice.pdf": filepath.Join(dir, "freebox", "invoice.pdf"),
+		"a/../invoice.pdf":    filepath.Join(dir, "invoice.pdf"),
+		"../x":                "",
+		"a/../../x":           "",
+		"..":                  "",
+		"/etc/passwd":         "",
+		"":                    "",
+		".":                   "",
+	}
+
+	for name, want := range tests {
+		got, err := safePath(dir, name)
+		if want == "" {
+			if !errors.Is(err, ErrUnsafeName) {
+				t.Errorf("%q: got %q, %v, want %v", name, got, err, ErrUnsafeName)
+			}
+
+			continue
+		}
+
+		if err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestSanitiseName(t *testing.T) {
+	tests := map[string]string{
+		"facture.pdf":    "facture.pdf",
+		"":               "document",
+		"..":             "document",
+		"../../etc/x":    "_.._etc_x",
+		"a/b:c.pdf":      "a_b_c.pdf",
+		" invoice.pdf. ": "invoice.pdf",
+	}
+
+	for name, want := range tests {
+		if got := sanitiseName(name); got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+// tmpFile writes content to a new file in dir and returns its path and SHA-256.
+func tmpFile(t *testing.T, dir, content string) (string, string) {
+	t.Helper()
+
+	file, err := os.CreateTemp(dir, ".*.part")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := manifest.FileSum(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return file.Name(), sum
+}
+
+func TestPlace(t *testing.T) {
+	tests := []struct {
+		collision Collision
+		second    string
+		// want are the names the two documents are saved under, empty when not saved, and the resulting files.
+		want  [2]string
+		files map[string]string
+	}{
+		{CollisionSkip, "new", [2]string{"a.pdf", ""}, map[string]string{"a.pdf": "old"}},
+		{CollisionOverwrite, "new", [2]string{"a.pdf", "a.pdf"}, map[string]string{"a.pdf": "new"}},
+		{CollisionSuffix, "old", [2]string{"a.pdf", "a (1).pdf"}, map[string]string{"a.pdf": "old", "a (1).pdf": "old"}},
+		{CollisionCompareHash, "old", [2]string{"a.pdf", ""}, map[string]string{"a.pdf": "old"}},
+		{CollisionCompareHash, "new", [2]string{"a.pdf", "a (1).pdf"}, map[string]string{"a.pdf": "old", "a (1).pdf": "new"}},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "a.pdf")
+
+		for i, content := range []string{"old", test.second} {
+			tmpPath, sum := tmpFile(t, dir, content)
+
+			saved, err := place(tmpPath, path, sum, test.collision)
+			if err != nil {
+				t.Fatalf("%s %d: %v", test.collision, i, err)
+			}
+
+			want := ""
+			if test.want[i] != "" {
+				want = filepath.Join(dir, test.want[i])
+			}
+
+			if saved != want {
+				t.Errorf("%s %d: saved as %q, want %q", test.collision, i, saved, want)
+			}
+
+			_ = os.Remove(tmpPath)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) != len(test.files) {
+			t.Errorf("%s %s: got %d files, want %d", test.collision, test.second, len(entries), len(test.files))
+		}
+
+		for name, want := range test.files {
+			content, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(content) != want {
+				t.Errorf("%s %s: %s holds %q, %v, want %q", test.collision, test.second, name, content, err, want)
+			}
+		}
+	}
+}
+
+func TestCreateExclusiveCopies(t *testing.T) {
+	// File systems such as vfat do not support hard links.
+	link = func(string, string) error { return &os.LinkError{Op: "link", Err: syscall.EPERM} }
+	t.Cleanup(func() { link = os.Link })
+
+	dir := t.TempDir()
+	tmpPath, _ := tmpFile(t, dir, "content")
+	path := filepath.Join(dir, "a.pdf")
+
+	if err := createExclusive(tmpPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "content" {
+		t.Errorf("got %q, %v, want %q", content, err, "content")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("got mode %v, %v, want %v", info.Mode().Perm(), err, os.FileMode(0o600))
+	}
+
+	if err := createExclusive(tmpPath, path); !errors.Is(err, os.ErrExist) {
+		t.Errorf("got %v, want %v", err, os.ErrExist)
+	}
+
+	if saved, err := place(tmpPath, path, "", CollisionSuffix); err != nil || saved != filepath.Join(dir, "a (1).pdf") {
+		t.Errorf("got %q, %v, want a (1).pdf", saved, err)
+	}
+}
@@ -0,0 +1,105 @@
+package pw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/atomicfile"
+	"github.com/Crocmagnon/downloader-go/internal/xdg"
+	"github.com/playwright-community/playwright-go"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSessionDir returns the directory holding session files, under the XDG state directory.
+func DefaultSessionDir() string {
+	return xdg.StateDir("sessions")
+}
+
+// DefaultQuarantineDir returns the directory holding rejected downloads, under the XDG state directory.
+func DefaultQuarantineDir() string {
+	return xdg.StateDir("quarantine")
+}
+
+// SessionFile returns the session file of the account of a provider in dir.
+func SessionFile(dir, provider, account string) string {
+	if account == "" {
+		account = "default"
+	}
+
+	return filepath.Join(dir, provider, strings.ReplaceAll(account, string(filepath.Separator), "_")+".json")
+}
+
+// saveStorageState saves the cookies and local storage of context to filename, encrypted with cipher if not nil.
+// IndexedDB is not part of the storage state in the Playwright version in use.
+func saveStorageState(context playwright.BrowserContext, filename string, cipher *SessionCipher) error {
+	state, err := context.StorageState()
+	if err != nil {
+		return fmt.Errorf("getting storage state: %w", err)
+	}
+
+	optState := playwright.OptionalStorageState{
+		Cookies: make([]playwright.OptionalCookie, 0, len(state.Cookies)),
+		Origins: state.Origins,
+	}
+
+	for _, cookie := range state.Cookies {
+		optState.Cookies = append(optState.Cookies, cookie.ToOptionalCookie())
+	}
+
+	asJSON, err := json.Marshal(optState)
+	if err != nil {
+		return fmt.Errorf("marshaling storage state: %w", err)
+	}
+
+	if cipher != nil {
+		if asJSON, err = cipher.encrypt(asJSON); err != nil {
+			return err
+		}
+	}
+
+	const dirPerm = 0o700
+	if err := os.MkdirAll(filepath.Dir(filename), dirPerm); err != nil {
+		return fmt.Errorf("creating session directory: %w", err)
+	}
+
+	// The session is never left truncated.
+	return atomicfile.Write(filename, asJSON)
+}
+
+// loadStorageState reads the storage state saved in filename, decrypting it with cipher if it is encrypted.
+// Unencrypted files are read even when cipher is set, they are encrypted on the next save.
+// Files holding only a list of cookies, as saved by previous versions, are supported.
+func loadStorageState(filename string, cipher *SessionCipher) (*playwright.OptionalStorageState, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+
+	if isEncrypted(content) {
+		if cipher == nil {
+			return nil, fmt.Errorf("%s: %w", filename, ErrEncryptedSession)
+		}
+
+		if content, err = cipher.decrypt(content); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+
+	var state playwright.OptionalStorageState
+
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		if err := json.Unmarshal(content, &state.Cookies); err != nil {
+			return nil, fmt.Errorf("%s: %w: %w", filename, ErrCorruptedSession, err)
+		}
+
+		return &state, nil
+	}
+
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("%s: %w: %w", filename, ErrCorruptedSession, err)
+	}
+
+	return &state, nil
+}
@@ -0,0 +1,71 @@
+package pw
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/atomicfile"
+	"net/url"
+	"runtime/debug"
+	"time"
+)
+
+// Sidecar is the metadata written next to a saved document, in a JSON file named after it, e.g. invoice.pdf.json.
+type Sidecar struct {
+	Provider string `json:"provider"`
+	Account  string `json:"account,omitempty"`
+	Type     string `json:"type"`
+	// Date is the date of the document as listed by the provider, formatted as 2006-01-02. It is empty when unknown.
+	Date         string    `json:"date,omitempty"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	// URL is where the document was downloaded from, without its query and fragment which may hold tokens.
+	URL              string `json:"url"`
+	OriginalFilename string `json:"original_filename"`
+	SHA256           string `json:"sha256"`
+	ToolVersion      string `json:"tool_version"`
+}
+
+// write writes the sidecar of the document saved at path.
+func (s Sidecar) write(path string) error {
+	s.ToolVersion = toolVersion()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling sidecar: %w", err)
+	}
+
+	if err := atomicfile.Write(path+".json", append(content, '\n')); err != nil {
+		return fmt.Errorf("writing sidecar: %w", err)
+	}
+
+	return nil
+}
+
+// stripURL returns raw without its credentials, query and fragment, or only its scheme for URLs such as data: ones.
+func stripURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	if u.Opaque != "" {
+		return u.Scheme + ":"
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	return u.String()
+}
+
+// toolVersion returns the version of the downloader, as recorded by go build or go install.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	return info.Main.Version
+}
@@ -0,0 +1,114 @@
+package pw
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPDF = fmt.Errorf("%w: not a valid PDF", errs.ErrInvalidDocument)
+
+// minPDFSize is the size under which a file cannot hold a readable PDF page.
+const minPDFSize = 256
+
+var (
+	// pageObject matches page objects but not the page tree nodes, /Type /Pages.
+	pageObject = regexp.MustCompile(`/Type\s*/Page\b`)
+	pageCount  = regexp.MustCompile(`/Count\s+(\d+)`)
+	startXref  = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+)
+
+// isPDF reports whether a document named name or suggested as suggested is meant to be a PDF.
+func isPDF(name, suggested string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".pdf") || strings.EqualFold(filepath.Ext(suggested), ".pdf")
+}
+
+// validatePDF checks that the file at path looks like a complete PDF, with pages pages if not zero.
+// It returns the number of pages, zero when they cannot be counted, e.g. when page objects are compressed.
+func validatePDF(path string, pages int) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if len(content) < minPDFSize {
+		return 0, fmt.Errorf("%w: %d bytes", ErrInvalidPDF, len(content))
+	}
+
+	// Readers accept a PDF header anywhere in the first kilobyte.
+	const headerWindow = 1024
+	if !bytes.Contains(content[:min(len(content), headerWindow)], []byte("%PDF-")) {
+		return 0, fmt.Errorf("%w: no PDF header, starts with %q", ErrInvalidPDF, content[:min(len(content), 16)])
+	}
+
+	// A complete PDF ends with the offset of its cross-reference table, which tells truncated files apart.
+	const trailerWindow = 1024
+	match := startXref.FindSubmatch(content[max(0, len(content)-trailerWindow):])
+
+	if match == nil {
+		return 0, fmt.Errorf("%w: no trailer, the file is likely truncated", ErrInvalidPDF)
+	}
+
+	if offset, err := strconv.Atoi(string(match[1])); err != nil || offset >= len(content) {
+		return 0, fmt.Errorf("%w: cross-reference table out of the file", ErrInvalidPDF)
+	}
+
+	count := countPages(content)
+
+	if pages > 0 && count > 0 && count != pages {
+		return count, fmt.Errorf("%w: %d pages, expected %d", ErrInvalidPDF, count, pages)
+	}
+
+	return count, nil
+}
+
+// countPages returns the number of pages of the PDF content, or zero when they cannot be counted.
+func countPages(content []byte) int {
+	if count := len(pageObject.FindAll(content, -1)); count > 0 {
+		return count
+	}
+
+	// Page objects may be compressed while the page tree is not: its root has the largest count.
+	count := 0
+
+	for _, match := range pageCount.FindAllSubmatch(content, -1) {
+		if n, err := strconv.Atoi(string(match[1])); err == nil {
+			count = max(count, n)
+		}
+	}
+
+	return count
+}
+
+// quarantine copies the rejected file at tmpPath to dir, under a name made of the current time and name,
+// and returns where. It returns an empty path when dir is empty.
+func quarantine(tmpPath, dir, name string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+
+	content, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("quarantining %s: %w", name, err)
+	}
+
+	const dirPerm, filePerm = 0o700, 0o600
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return "", fmt.Errorf("quarantining %s: %w", name, err)
+	}
+
+	path := filepath.Join(dir, time.Now().Format("20060102T150405")+"-"+filepath.Base(name))
+
+	// The quarantine usually lives on another file system than the output directory, so the file is copied.
+	if err := os.WriteFile(path, content, filePerm); err != nil {
+		return "", fmt.Errorf("quarantining %s: %w", name, err)
+	}
+
+	return path, nil
+}
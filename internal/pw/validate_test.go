@@ -0,0 +1,85 @@
+package pw
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pdf returns a minimal PDF with pages pages, each described by its own object.
+func pdf(pages int) string {
+	var builder strings.Builder
+
+	builder.WriteString("%PDF-1.7\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	_, _ = fmt.Fprintf(&builder, "2 0 obj << /Type /Pages /Count %d >> endobj\n", pages)
+
+	for i := range pages {
+		_, _ = fmt.Fprintf(&builder, "%d 0 obj << /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >> endobj\n", i+3)
+	}
+
+	xref := builder.Len()
+	builder.WriteString("xref\n0 1\n0000000000 65535 f \ntrailer << /Root 1 0 R >>\n")
+	_, _ = fmt.Fprintf(&builder, "startxref\n%d\n%%%%EOF\n", xref)
+
+	return builder.String()
+}
+
+func TestValidatePDF(t *testing.T) {
+	compressed := strings.ReplaceAll(pdf(3), "/Type /Page /Parent", "/Parent")
+
+	tests := []struct {
+		name      string
+		content   string
+		pages     int
+		wantPages int
+		wantErr   bool
+	}{
+		{"valid", pdf(2), 0, 2, false},
+		{"expected pages", pdf(2), 2, 2, false},
+		{"page count mismatch", pdf(2), 1, 2, true},
+		{"pages counted from the page tree", compressed, 3, 3, false},
+		{"truncated", pdf(2)[:len(pdf(2))-40], 0, 0, true},
+		{"html error page", "<!DOCTYPE html><html><body>" + strings.Repeat("Session expired. ", 30) + "</body></html>", 0, 0, true},
+		{"empty", "", 0, 0, true},
+		{"too small", "%PDF-1.7\nstartxref\n0\n%%EOF\n", 0, 0, true},
+		{"header after a preamble", strings.Repeat(" ", 100) + pdf(1), 0, 1, false},
+		{"xref out of the file", strings.Replace(pdf(1), "startxref\n", "startxref\n99999", 1), 0, 0, true},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "document.pdf")
+		if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		pages, err := validatePDF(path, test.pages)
+		if test.wantErr != errors.Is(err, ErrInvalidPDF) {
+			t.Errorf("%s: got error %v, want one: %t", test.name, err, test.wantErr)
+		}
+
+		if pages != test.wantPages {
+			t.Errorf("%s: got %d pages, want %d", test.name, pages, test.wantPages)
+		}
+	}
+}
+
+func TestIsPDF(t *testing.T) {
+	tests := []struct {
+		name, suggested string
+		want            bool
+	}{
+		{"2024-03-invoice.pdf", "facture.pdf", true},
+		{"2024-03-invoice.PDF", "", true},
+		{"2024-03-invoice", "facture.pdf", true},
+		{"export.csv", "export.csv", false},
+	}
+
+	for _, test := range tests {
+		if got := isPDF(test.name, test.suggested); got != test.want {
+			t.Errorf("%s, %s: got %t, want %t", test.name, test.suggested, got, test.want)
+		}
+	}
+}
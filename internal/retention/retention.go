@@ -0,0 +1,180 @@
+// Package retention deletes saved documents once they are older than the retention period of their type.
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidAge          = errors.New("invalid retention period")
+	ErrUnknownDocumentType = errors.New("unknown document type")
+	ErrContentChanged      = errors.New("content differs from the saved document")
+)
+
+// Age is a retention period in calendar units.
+type Age struct {
+	Years, Months, Days int
+}
+
+var agePattern = regexp.MustCompile(`^(\d+)(d|w|mo|y)$`)
+
+// ParseAge parses a retention period such as 30d, 2w, 6mo or 10y.
+func ParseAge(value string) (Age, error) {
+	match := agePattern.FindStringSubmatch(value)
+	if match == nil {
+		return Age{}, fmt.Errorf("%w: %q, expected a number followed by d, w, mo or y, e.g. 6mo", ErrInvalidAge, value)
+	}
+
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return Age{}, fmt.Errorf("%w: %q: %w", ErrInvalidAge, value, err)
+	}
+
+	const daysPerWeek = 7
+
+	switch match[2] {
+	case "d":
+		return Age{Days: n}, nil
+	case "w":
+		return Age{Days: n * daysPerWeek}, nil
+	case "mo":
+		return Age{Months: n}, nil
+	default:
+		return Age{Years: n}, nil
+	}
+}
+
+// Cutoff returns the date before which documents are older than a at now.
+func (a Age) Cutoff(now time.Time) time.Time {
+	return now.AddDate(-a.Years, -a.Months, -a.Days)
+}
+
+// Policy is how long documents are kept, by type. Types absent from the policy are kept forever.
+type Policy map[provider.DocumentType]Age
+
+// ParsePolicy parses rules mapping document types to retention periods, e.g. proof-of-address: 6mo.
+func ParsePolicy(rules map[string]string) (Policy, error) {
+	policy := make(Policy, len(rules))
+
+	for name, value := range rules {
+		docType := provider.DocumentType(name)
+		if !slices.Contains(provider.AllDocumentTypes, docType) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownDocumentType, name)
+		}
+
+		age, err := ParseAge(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		policy[docType] = age
+	}
+
+	return policy, nil
+}
+
+// Candidate is a saved document older than the policy allows.
+type Candidate struct {
+	// Path is where the document is saved, in the output directory.
+	Path string
+	Type provider.DocumentType
+	// Date is the date of the document, or when it was saved if unknown.
+	Date time.Time
+	// SHA256 is the hex-encoded SHA-256 of the saved document, the file at Path is only deleted if it matches.
+	SHA256 string
+}
+
+// Expired returns the documents recorded in entries and saved in dir that are older than the policy allows at now.
+// typeOf returns the type of the documents of a provider. Only regular files with the content recorded in entries
+// are returned: documents moved away from dir, e.g. by another tool, and files since replaced by another document,
+// e.g. when overwriting or saving to another output directory, are left out.
+func (p Policy) Expired(
+	entries []manifest.Entry,
+	dir string,
+	typeOf func(provider string) provider.DocumentType,
+	now time.Time,
+) []Candidate {
+	var candidates []Candidate
+
+	seen := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		name := filepath.Clean(filepath.FromSlash(entry.Path))
+		if !filepath.IsLocal(name) || seen[name] || entry.SHA256 == "" {
+			continue
+		}
+
+		docType := typeOf(entry.Provider)
+
+		age, ok := p[docType]
+		if !ok {
+			continue
+		}
+
+		date := entry.SavedAt
+		if parsed, err := time.Parse(time.DateOnly, entry.Date); err == nil {
+			date = parsed
+		}
+
+		if !date.Before(age.Cutoff(now)) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+
+		if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		if sum, err := manifest.FileSum(path); err != nil || sum != entry.SHA256 {
+			continue
+		}
+
+		seen[name] = true
+
+		candidates = append(candidates, Candidate{Path: path, Type: docType, Date: date, SHA256: entry.SHA256})
+	}
+
+	return candidates
+}
+
+// Delete deletes the document of c along with its metadata sidecar, then the directories left empty up to dir.
+// It refuses to delete the file at c.Path if its content no longer matches c.SHA256.
+func Delete(dir string, c Candidate) error {
+	sum, err := manifest.FileSum(c.Path)
+	if err != nil {
+		return err
+	}
+
+	if sum != c.SHA256 {
+		return fmt.Errorf("deleting %s: %w", c.Path, ErrContentChanged)
+	}
+
+	if err := os.Remove(c.Path); err != nil {
+		return fmt.Errorf("deleting %s: %w", c.Path, err)
+	}
+
+	// See pw.Sidecar.
+	if err := os.Remove(c.Path + ".json"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting sidecar of %s: %w", c.Path, err)
+	}
+
+	for parent := filepath.Dir(c.Path); parent != filepath.Clean(dir); parent = filepath.Dir(parent) {
+		// Fails on directories that are not empty.
+		if err := os.Remove(parent); err != nil {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package retention
+
+import (
+	"errors"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]Age{
+		"30d":  {Days: 30},
+		"2w":   {Days: 14},
+		"6mo":  {Months: 6},
+		"10y":  {Years: 10},
+		"0d":   {},
+		"120d": {Days: 120},
+	}
+
+	for value, want := range tests {
+		got, err := ParseAge(value)
+		if err != nil || got != want {
+			t.Errorf("%q: got %+v, %v, want %+v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "6", "6m", "mo", "-1d", "1.5y", "6 mo", "6MO"} {
+		if _, err := ParseAge(value); !errors.Is(err, ErrInvalidAge) {
+			t.Errorf("%q: got %v, want %v", value, err, ErrInvalidAge)
+		}
+	}
+}
+
+func TestCutoff(t *testing.T) {
+	tests := []struct {
+		age  Age
+		now  time.Time
+		want time.Time
+	}{
+		{Age{Months: 6}, date(2024, 8, 15), date(2024, 2, 15)},
+		{Age{Months: 1}, date(2024, 3, 15), date(2024, 2, 15)},
+		{Age{Years: 1}, date(2024, 2, 29), date(2023, 3, 1)},
+		// Go normalises day overflows: a month before March 31st is March 2nd, 2024 being a leap year.
+		{Age{Months: 1}, date(2024, 3, 31), date(2024, 3, 2)},
+		{Age{Days: 14}, date(2024, 1, 10), date(2023, 12, 27)},
+	}
+
+	for _, test := range tests {
+		if got := test.age.Cutoff(test.now); !got.Equal(test.want) {
+			t.Errorf("%+v at %s: got %s, want %s", test.age, test.now.Format(time.DateOnly), got.Format(time.DateOnly),
+				test.want.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(map[string]string{"invoice": "2y", "proof-of-address": "6mo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy["invoice"] != (Age{Years: 2}) || policy["proof-of-address"] != (Age{Months: 6}) {
+		t.Errorf("got %+v", policy)
+	}
+
+	if _, err := ParsePolicy(map[string]string{"receipt": "1y"}); !errors.Is(err, ErrUnknownDocumentType) {
+		t.Errorf("got %v, want %v", err, ErrUnknownDocumentType)
+	}
+
+	if _, err := ParsePolicy(map[string]string{"invoice": "forever"}); !errors.Is(err, ErrInvalidAge) {
+		t.Errorf("got %v, want %v", err, ErrInvalidAge)
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// save writes content to name in dir and returns its SHA-256.
+func save(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := manifest.FileSum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sum
+}
+
+func TestExpired(t *testing.T) {
+	dir := t.TempDir()
+	now := date(2024, 6, 1)
+	saved := date(2024, 5, 1)
+
+	oldSum := save(t, dir, "freebox/2020/old.pdf", "old")
+	recentSum := save(t, dir, "freebox/2024/recent.pdf", "recent")
+	undatedSum := save(t, dir, "undated.pdf", "undated")
+	replacedSum := save(t, dir, "replaced.pdf", "replaced")
+	save(t, dir, "replaced.pdf", "newer document")
+	keptSum := save(t, dir, "payslip.pdf", "payslip")
+	save(t, dir, "untracked.pdf", "untracked")
+
+	entries := []manifest.Entry{
+		{Provider: "freebox", Date: "2020-01-01", Path: "freebox/2020/old.pdf", SHA256: oldSum, SavedAt: saved},
+		{Provider: "freebox", Date: "2024-05-01", Path: "freebox/2024/recent.pdf", SHA256: recentSum, SavedAt: saved},
+		// The site listed no date, the document is dated when saved.
+		{Provider: "freebox", Path: "undated.pdf", SHA256: undatedSum, SavedAt: date(2019, 1, 1)},
+		// Overwritten by a newer document since.
+		{Provider: "freebox", Date: "2020-01-01", Path: "replaced.pdf", SHA256: replacedSum, SavedAt: saved},
+		// Moved away by another tool.
+		{Provider: "freebox", Date: "2020-01-01", Path: "moved.pdf", SHA256: oldSum, SavedAt: saved},
+		{Provider: "freebox", Date: "2020-01-01", Path: "../outside.pdf", SHA256: oldSum, SavedAt: saved},
+		// No retention period for payslips.
+		{Provider: "shiva", Date: "2000-01-01", Path: "payslip.pdf", SHA256: keptSum, SavedAt: saved},
+	}
+
+	typeOf := func(name string) provider.DocumentType {
+		if name == "shiva" {
+			return "payslip"
+		}
+
+		return "invoice"
+	}
+
+	candidates := Policy{"invoice": {Years: 1}}.Expired(entries, dir, typeOf, now)
+
+	want := []Candidate{
+		{Path: filepath.Join(dir, "freebox", "2020", "old.pdf"), Type: "invoice", Date: date(2020, 1, 1), SHA256: oldSum},
+		{Path: filepath.Join(dir, "undated.pdf"), Type: "invoice", Date: date(2019, 1, 1), SHA256: undatedSum},
+	}
+
+	if len(candidates) != len(want) {
+		t.Fatalf("got %+v, want %+v", candidates, want)
+	}
+
+	for i := range want {
+		if candidates[i] != want[i] {
+			t.Errorf("got %+v, want %+v", candidates[i], want[i])
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	dir := t.TempDir()
+	sum := save(t, dir, "freebox/2020/old.pdf", "old")
+	save(t, dir, "freebox/2020/old.pdf.json", "{}")
+	save(t, dir, "freebox/2021/other.pdf", "other")
+
+	candidate := Candidate{Path: filepath.Join(dir, "freebox", "2020", "old.pdf"), SHA256: sum}
+
+	if err := Delete(dir, candidate); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"freebox/2020/old.pdf", "freebox/2020/old.pdf.json", "freebox/2020"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: got %v, want it deleted", name, err)
+		}
+	}
+
+	// Directories still holding documents are kept.
+	if _, err := os.Stat(filepath.Join(dir, "freebox", "2021", "other.pdf")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteReplaced(t *testing.T) {
+	dir := t.TempDir()
+	sum := save(t, dir, "old.pdf", "old")
+	save(t, dir, "old.pdf", "replaced meanwhile")
+
+	err := Delete(dir, Candidate{Path: filepath.Join(dir, "old.pdf"), SHA256: sum})
+	if !errors.Is(err, ErrContentChanged) {
+		t.Errorf("got %v, want %v", err, ErrContentChanged)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "old.pdf")); err != nil {
+		t.Errorf("replaced file deleted: %v", err)
+	}
+}
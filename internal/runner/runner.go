@@ -0,0 +1,206 @@
+// Package runner runs several providers in a row and summarises the outcome.
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"github.com/Crocmagnon/downloader-go/internal/pw"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	ErrNotConfigured   = errors.New("not configured")
+	ErrUnknownProvider = errors.New("unknown provider")
+)
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+// Job is a provider to run with its options.
+type Job struct {
+	Provider provider.Provider
+	Options  provider.Options
+	// Err is set when the job cannot run, e.g. ErrNotConfigured when credentials are missing.
+	Err error
+}
+
+// Result is the outcome of a single provider run.
+type Result struct {
+	Provider string `json:"provider"`
+	Account  string `json:"account,omitempty"`
+	Status   Status `json:"status"`
+	provider.Result
+	Err error `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler, writing Err as a string.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type plain Result
+
+	var errMsg string
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+
+	// Empty lists rather than null, for consumers iterating over them.
+	if r.Saved == nil {
+		r.Saved = []pw.Document{}
+	}
+
+	if r.Skipped == nil {
+		r.Skipped = []pw.Document{}
+	}
+
+	if r.Warnings == nil {
+		r.Warnings = []string{}
+	}
+
+	return json.Marshal(struct {
+		plain
+		Error string `json:"error,omitempty"`
+	}{plain(r), errMsg})
+}
+
+// Select returns the providers of reg to run: only those listed in only if it is not empty,
+// minus those listed in skip.
+func Select(reg *provider.Registry, only, skip []string) ([]provider.Provider, error) {
+	for _, name := range slices.Concat(only, skip) {
+		if _, ok := reg.Get(name); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+	}
+
+	var selected []provider.Provider
+
+	for _, prov := range reg.All() {
+		if len(only) > 0 && !slices.Contains(only, prov.Name()) {
+			continue
+		}
+
+		if slices.Contains(skip, prov.Name()) {
+			continue
+		}
+
+		selected = append(selected, prov)
+	}
+
+	return selected, nil
+}
+
+// Run runs every job in turn, continuing past failures.
+// Once ctx is done, the remaining jobs fail without running.
+func Run(ctx context.Context, jobs []Job) []Result {
+	results := make([]Result, 0, len(jobs))
+
+	for _, job := range jobs {
+		if job.Err == nil {
+			job.Err = ctx.Err()
+		}
+
+		results = append(results, runOne(ctx, job))
+	}
+
+	return results
+}
+
+func runOne(ctx context.Context, job Job) Result {
+	opts := job.Options
+	result := Result{Provider: job.Provider.Name(), Account: opts.Account}
+
+	if job.Err != nil {
+		result.Status = StatusFailed
+		if errors.Is(job.Err, ErrNotConfigured) {
+			result.Status = StatusSkipped
+		}
+
+		result.Err = job.Err
+
+		return result
+	}
+
+	opts.Log().Info("running")
+
+	var err error
+
+	result.Result, err = job.Provider.Run(ctx, opts)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Err = err
+	} else {
+		result.Status = StatusOK
+		opts.Log().Info("done", "saved", len(result.Saved), "skipped", len(result.Skipped))
+	}
+
+	return result
+}
+
+// Failed returns the number of failed runs in results.
+func Failed(results []Result) int {
+	failed := 0
+
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// PrintSummary writes a table describing results to w.
+func PrintSummary(w io.Writer, results []Result) {
+	const padding = 2
+
+	table := tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
+	_, _ = fmt.Fprintln(table, "PROVIDER\tACCOUNT\tSTATUS\tFILES\tERROR")
+
+	for _, result := range results {
+		names := make([]string, 0, len(result.Saved))
+		for _, doc := range result.Saved {
+			names = append(names, filepath.Base(doc.Path))
+		}
+
+		files := strings.Join(names, ", ")
+		if files == "" {
+			files = "-"
+		}
+
+		errMsg := "-"
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+
+		account := result.Account
+		if account == "" {
+			account = "-"
+		}
+
+		_, _ = fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", result.Provider, account, result.Status, files, errMsg)
+	}
+
+	_ = table.Flush()
+}
+
+// PrintJSON writes results to w as a JSON array, along with the warnings of each run.
+func PrintJSON(w io.Writer, results []Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(results); err != nil {
+		return fmt.Errorf("writing results: %w", err)
+	}
+
+	return nil
+}
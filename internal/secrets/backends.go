@@ -0,0 +1,202 @@
+package secrets
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds the run of the commands of Pass and Exec when they set no timeout.
+const DefaultTimeout = 30 * time.Second
+
+// Pass reads secrets from the pass password manager. The reference is the name of the entry,
+// only its first line is used.
+type Pass struct {
+	Command string
+	// Timeout bounds the run of the command, DefaultTimeout when zero.
+	Timeout time.Duration
+}
+
+func (p *Pass) Resolve(ref string) (string, error) {
+	command := p.Command
+	if command == "" {
+		command = "pass"
+	}
+
+	out, err := run(p.Timeout, command, "show", ref)
+	if err != nil {
+		return "", err
+	}
+
+	first, _, _ := strings.Cut(out, "\n")
+
+	return first, nil
+}
+
+// Exec runs a command and uses its output as the secret. The reference is the command line,
+// split on spaces without going through a shell.
+type Exec struct {
+	// Timeout bounds the run of the command, DefaultTimeout when zero.
+	Timeout time.Duration
+}
+
+func (e *Exec) Resolve(ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", fmt.Errorf("%w: empty command", ErrNotFound)
+	}
+
+	return run(e.Timeout, args[0], args[1:]...)
+}
+
+// run runs command with args, killing it after timeout, and returns its output.
+func run(timeout time.Duration, command string, args ...string) (string, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(timeout, DefaultTimeout))
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Do not wait for the output of children the command left behind once killed.
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", fmt.Errorf("running %s: %w", command, ctxErr)
+		}
+
+		return "", fmt.Errorf("running %s: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// Age decrypts age-encrypted files with the identities in IdentityFile.
+// The reference is the file path, optionally followed by # and a dotted path into the decrypted
+// YAML or JSON document, e.g. /secrets/creds.age#lcl.password.
+// Without a fragment, the whole decrypted content is the secret.
+type Age struct {
+	IdentityFile string
+
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (a *Age) Resolve(ref string) (string, error) {
+	path, fragment, _ := strings.Cut(ref, "#")
+
+	content, err := a.decrypt(path)
+	if err != nil {
+		return "", err
+	}
+
+	if fragment == "" {
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	var doc any
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return "", fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for _, key := range strings.Split(fragment, ".") {
+		values, ok := doc.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("%w: %s in %s", ErrNotFound, fragment, path)
+		}
+
+		if doc, ok = values[key]; !ok {
+			return "", fmt.Errorf("%w: %s in %s", ErrNotFound, fragment, path)
+		}
+	}
+
+	switch value := doc.(type) {
+	case string:
+		return value, nil
+	case int, float64, bool:
+		return fmt.Sprint(value), nil
+	default:
+		return "", fmt.Errorf("%w: %s in %s is not a scalar", ErrNotFound, fragment, path)
+	}
+}
+
+// decrypt returns the decrypted content of the file at path, decrypting each file once.
+func (a *Age) decrypt(path string) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if content, ok := a.files[path]; ok {
+		return content, nil
+	}
+
+	if a.IdentityFile == "" {
+		return nil, fmt.Errorf("%w: no age identity file configured", ErrBackendUnavailable)
+	}
+
+	identities, err := readIdentities(a.IdentityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	reader, err := age.Decrypt(file, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", path, err)
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", path, err)
+	}
+
+	if a.files == nil {
+		a.files = make(map[string][]byte)
+	}
+
+	a.files[path] = content
+
+	return content, nil
+}
+
+func readIdentities(path string) ([]age.Identity, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("parsing identities from %s: %w", path, err)
+	}
+
+	return identities, nil
+}
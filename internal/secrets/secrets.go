@@ -0,0 +1,86 @@
+// Package secrets resolves credential references such as pass:banks/lcl to their value.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrBackendUnavailable = errors.New("secret backend unavailable")
+	ErrNotFound           = errors.New("secret not found")
+)
+
+// Backend resolves references of a single scheme, e.g. banks/lcl for pass:banks/lcl.
+type Backend interface {
+	Resolve(ref string) (string, error)
+}
+
+// Resolver dispatches references to backends by scheme and caches resolved values.
+type Resolver struct {
+	backends map[string]Backend
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewResolver creates a resolver using backends, keyed by scheme.
+func NewResolver(backends map[string]Backend) *Resolver {
+	return &Resolver{backends: backends, cache: make(map[string]string)}
+}
+
+// Settings configure the default backends.
+type Settings struct {
+	// PassCommand is the pass executable, defaults to pass.
+	PassCommand string `yaml:"pass_command"`
+	// AgeIdentity is the age identity file used to decrypt age: references.
+	AgeIdentity string `yaml:"age_identity"`
+}
+
+// Default returns a resolver with the pass, age and exec backends.
+func Default(settings Settings) *Resolver {
+	return NewResolver(map[string]Backend{
+		"pass": &Pass{Command: settings.PassCommand},
+		"age":  &Age{IdentityFile: settings.AgeIdentity},
+		"exec": &Exec{},
+	})
+}
+
+// literal is the scheme of values to use as is, e.g. literal:pass:word for the password pass:word.
+const literal = "literal"
+
+// Resolve returns the secret referenced by value. Values without a known scheme prefix are returned unchanged,
+// as is the rest of values prefixed with literal:.
+func (r *Resolver) Resolve(value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+
+	if scheme == literal {
+		return ref, nil
+	}
+
+	backend, ok := r.backends[scheme]
+	if !ok {
+		return value, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if secret, ok := r.cache[value]; ok {
+		return secret, nil
+	}
+
+	secret, err := backend.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s secret: %w", scheme, err)
+	}
+
+	r.cache[value] = secret
+
+	return secret, nil
+}
@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"filippo.io/age"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stub writes an executable shell script running script to dir and returns its path.
+func stub(t *testing.T, dir, name, script string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// encrypt writes content encrypted to a new age identity to dir, and returns the paths of the file and the identity.
+func encrypt(t *testing.T, dir, content string) (string, string) {
+	t.Helper()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identityFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "creds.age")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	writer, err := age.Encrypt(file, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, identityFile
+}
+
+func TestPass(t *testing.T) {
+	dir := t.TempDir()
+	command := stub(t, dir, "pass", `[ "$1" = show ] && [ "$2" = banks/lcl ] || exit 1
+printf 'hunter2\nlogin: jdoe\n'`)
+
+	got, err := (&Pass{Command: command}).Resolve("banks/lcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "hunter2" {
+		t.Errorf("got %q, want %q", got, "hunter2")
+	}
+
+	if _, err := (&Pass{Command: command}).Resolve("banks/other"); err == nil {
+		t.Error("got no error for a missing entry")
+	}
+
+	if _, err := (&Pass{Command: filepath.Join(dir, "missing")}).Resolve("banks/lcl"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("got %v, want %v", err, ErrBackendUnavailable)
+	}
+}
+
+func TestExec(t *testing.T) {
+	dir := t.TempDir()
+	command := stub(t, dir, "get-secret", `printf '%s-secret\n' "$1"`)
+
+	got, err := (&Exec{}).Resolve(command + " lcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "lcl-secret" {
+		t.Errorf("got %q, want %q", got, "lcl-secret")
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	command := stub(t, t.TempDir(), "hang", "exec sleep 10")
+
+	start := time.Now()
+
+	_, err := (&Exec{Timeout: 100 * time.Millisecond}).Resolve(command)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+}
+
+func TestAge(t *testing.T) {
+	dir := t.TempDir()
+	path, identityFile := encrypt(t, dir, "lcl:\n  password: hunter2\n  pin: 1234\n")
+	backend := &Age{IdentityFile: identityFile}
+
+	tests := map[string]string{
+		path + "#lcl.password": "hunter2",
+		path + "#lcl.pin":      "1234",
+		path:                   "lcl:\n  password: hunter2\n  pin: 1234",
+	}
+
+	for ref, want := range tests {
+		got, err := backend.Resolve(ref)
+		if err != nil {
+			t.Fatalf("%s: %v", ref, err)
+		}
+
+		if got != want {
+			t.Errorf("%s: got %q, want %q", ref, got, want)
+		}
+	}
+
+	for _, ref := range []string{path + "#lcl.missing", path + "#lcl"} {
+		if _, err := backend.Resolve(ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: got %v, want %v", ref, err, ErrNotFound)
+		}
+	}
+
+	if _, err := (&Age{}).Resolve(path); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("got %v, want %v", err, ErrBackendUnavailable)
+	}
+}
+
+// counter counts the references it resolves.
+type counter struct {
+	calls int
+}
+
+func (c *counter) Resolve(ref string) (string, error) {
+	c.calls++
+
+	return "resolved " + ref, nil
+}
+
+func TestResolver(t *testing.T) {
+	backend := &counter{}
+	resolver := NewResolver(map[string]Backend{"pass": backend})
+
+	tests := map[string]string{
+		"hunter2":             "hunter2",
+		"pass:banks/lcl":      "resolved banks/lcl",
+		"literal:pass:word":   "pass:word",
+		"unknown:banks/lcl":   "unknown:banks/lcl",
+		"literal:":            "",
+		"https://example.com": "https://example.com",
+	}
+
+	for value, want := range tests {
+		got, err := resolver.Resolve(value)
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+
+		if got != want {
+			t.Errorf("%s: got %q, want %q", value, got, want)
+		}
+	}
+
+	if _, err := resolver.Resolve("pass:banks/lcl"); err != nil {
+		t.Fatal(err)
+	}
+
+	if backend.calls != 1 {
+		t.Errorf("backend called %d times, want 1", backend.calls)
+	}
+}
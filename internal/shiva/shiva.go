@@ -1,24 +1,51 @@
 package shiva
 
 import (
+	"context"
 	"fmt"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
 	"github.com/Crocmagnon/downloader-go/internal/pw"
 	"github.com/playwright-community/playwright-go"
-	"io"
 )
 
-func Run(stdout, stderr io.Writer, headless bool, username, password, dir string) error {
-	return pw.Run(stdout, stderr, headless, pw.BrowserFirefox, func(page playwright.Page) error {
-		return downloadFile(page, username, password, dir)
+// Provider implements provider.Provider for Shiva.
+type Provider struct{}
+
+func (Provider) Name() string { return "shiva" }
+
+func (Provider) Description() string { return "Download latest payslip from Shiva." }
+
+func (Provider) DocumentTypes() []provider.DocumentType {
+	return []provider.DocumentType{provider.DocumentPayslip}
+}
+
+func (Provider) Browser() pw.Browser { return pw.BrowserFirefox }
+
+func (Provider) CredentialFields() []provider.CredentialField {
+	return provider.UsernamePassword("Shiva")
+}
+
+func (Provider) Run(ctx context.Context, opts provider.Options) (provider.Result, error) {
+	return provider.Run(ctx, opts, func(page playwright.Page, session *pw.Session, opts provider.Options) error {
+		return downloadFile(page, session, opts.Credentials.Username(), opts.Credentials.Password(), opts)
 	})
 }
 
-func downloadFile(page playwright.Page, identifier, password, outputDir string) error {
+func downloadFile(page playwright.Page, session *pw.Session, identifier, password string, opts provider.Options) error {
+	opts.Log().Info("logging in")
+
 	if err := login(page, identifier, password); err != nil {
 		return fmt.Errorf("logging in: %w", err)
 	}
 
-	if err := downloadAndSave(page, outputDir); err != nil {
+	opts.Log().Info("logged in")
+
+	if err := session.Save(); err != nil {
+		return err
+	}
+
+	if err := downloadAndSave(page, opts); err != nil {
 		return fmt.Errorf("downloading and saving: %w", err)
 	}
 
@@ -26,9 +53,11 @@ func downloadFile(page playwright.Page, identifier, password, outputDir string)
 }
 
 func login(page playwright.Page, identifier, password string) error {
-	_, err := page.Goto("https://connect.shiva.fr/Account/Login")
+	const loginURL = "https://connect.shiva.fr/Account/Login"
+
+	err := pw.Goto(page, loginURL)
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
 	if err := page.Locator("#identifiantCtrl").Fill(identifier); err != nil {
@@ -43,21 +72,15 @@ func login(page playwright.Page, identifier, password string) error {
 		return fmt.Errorf("clicking login button: %w", err)
 	}
 
-	if err := page.WaitForURL("https://portail.shiva.fr/clients", playwright.PageWaitForURLOptions{Timeout: playwright.Float(5000)}); err != nil {
-		return fmt.Errorf("waiting for redirect: %w", err)
-	}
-
-	return nil
+	return pw.WaitForLogin(page, "https://portail.shiva.fr/clients", loginURL, errs.ErrBadCredentials)
 }
 
-func downloadAndSave(page playwright.Page, outputDir string) error {
-	_, err := page.Goto("https://portail.shiva.fr/clients/mes-intervenants")
+func downloadAndSave(page playwright.Page, opts provider.Options) error {
+	err := pw.Goto(page, "https://portail.shiva.fr/clients/mes-intervenants")
 	if err != nil {
-		return fmt.Errorf("going to: %w", err)
+		return err
 	}
 
-	// Nth(1) because there's a hidden button with the same selector displayed on mobile only.
-	return pw.Download(page, outputDir, func() error {
-		return page.Locator("tr .button-btn-download").Nth(1).Click()
-	})
+	// Every row has a hidden button with the same selector displayed on mobile only.
+	return provider.Download(page, opts, pw.Listing{Buttons: page.Locator("tr .button-btn-download >> visible=true")})
 }
@@ -0,0 +1,23 @@
+// Package xdg locates the files of the downloader in the XDG base directories.
+package xdg
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// StateDir returns the path of name in the directory of the downloader under the XDG state directory,
+// ~/.local/state/downloader by default. It is empty when the home directory is unknown.
+func StateDir(name string) string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(stateDir, "downloader", name)
+}
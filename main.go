@@ -1,99 +1,783 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/Crocmagnon/downloader-go/internal/eaudugrandlyon"
-	"github.com/Crocmagnon/downloader-go/internal/freebox"
-	"github.com/Crocmagnon/downloader-go/internal/freemobile"
-	"github.com/Crocmagnon/downloader-go/internal/lclchecking"
-	"github.com/Crocmagnon/downloader-go/internal/octopusenergyaddress"
-	"github.com/Crocmagnon/downloader-go/internal/shiva"
+	"github.com/Crocmagnon/downloader-go/internal/config"
+	"github.com/Crocmagnon/downloader-go/internal/credentials"
+	"github.com/Crocmagnon/downloader-go/internal/errs"
+	"github.com/Crocmagnon/downloader-go/internal/manifest"
+	"github.com/Crocmagnon/downloader-go/internal/naming"
+	"github.com/Crocmagnon/downloader-go/internal/provider"
+	"github.com/Crocmagnon/downloader-go/internal/providers"
+	"github.com/Crocmagnon/downloader-go/internal/pw"
+	"github.com/Crocmagnon/downloader-go/internal/retention"
+	"github.com/Crocmagnon/downloader-go/internal/runner"
+	"github.com/Crocmagnon/downloader-go/internal/secrets"
 	"github.com/alecthomas/kong"
+	"io"
+	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
+var (
+	errProvidersFailed  = errors.New("some providers failed")
+	errMissingOutputDir = errors.New("missing output directory, set --output-dir or output_dir in the configuration file")
+	errMissingCreds     = errors.New("missing credentials")
+	errInvalidConfig    = errors.New("invalid configuration")
+	errDoctor           = errors.New("doctor found problems")
+	errInvalidPeriod    = errors.New("invalid period")
+)
+
+const sessionPassphraseEnv = "DOWNLOADER_SESSION_PASSPHRASE"
+
+// defaultArtifactsKeep is the number of failure bundles kept per provider and account.
+const defaultArtifactsKeep = 10
+
+// defaultVideoMaxSize is the size in MiB over which videos are discarded.
+const defaultVideoMaxSize = 100
+
+// outputJSON is the --output format writing results as JSON.
+const outputJSON = "json"
+
 type Context struct {
-	OutputDir     string
-	Headless      bool
-	NoInteraction bool
+	OutputDir        string
+	SessionDir       string
+	SessionCipher    *pw.SessionCipher
+	DriverDir        string
+	QuarantineDir    string
+	ArtifactsDir     string
+	ArtifactsKeep    int
+	Trace            bool
+	RecordHAR        bool
+	Logger           *slog.Logger
+	Video            pw.Video
+	VideoMaxSize     int64
+	Headless         bool
+	NoInteraction    bool
+	All              bool
+	Period           provider.Period
+	Manifest         *manifest.Manifest
+	FilenameTemplate string
+	Layout           naming.Layout
+	Collision        pw.Collision
+	Output           string
+	Config           *config.Config
+	Secrets          *secrets.Resolver
 }
 
-type FreeboxCmd struct {
-	Username string `required:"" short:"u" help:"Freebox username"`
-	Password string `required:"" short:"p" help:"Freebox password"`
+// providerOptions returns the options to run prov with the given account.
+func (c *Context) providerOptions(prov provider.Provider, account string, creds provider.Credentials) (provider.Options, error) {
+	if c.OutputDir == "" {
+		return provider.Options{}, errMissingOutputDir
+	}
+
+	browser, err := c.Config.BrowserFor(prov)
+	if err != nil {
+		return provider.Options{}, err
+	}
+
+	template, err := c.filenameTemplate(prov)
+	if err != nil {
+		return provider.Options{}, err
+	}
+
+	template = template.In(c.Layout)
+
+	fields := naming.Fields{Provider: prov.Name(), Account: account}
+	if types := prov.DocumentTypes(); len(types) > 0 {
+		fields.Type = string(types[0])
+	}
+
+	logger := c.Logger.With("provider", prov.Name())
+	if account != "" {
+		logger = logger.With("account", account)
+	}
+
+	// Stdout is reserved for results.
+	return provider.Options{
+		Logger:          logger,
+		Stderr:          os.Stderr,
+		Stdin:           os.Stdin,
+		Headless:        c.Headless,
+		NoInteraction:   c.NoInteraction,
+		OutputDir:       c.OutputDir,
+		Browser:         browser,
+		All:             c.All,
+		Period:          c.Period,
+		Account:         account,
+		Credentials:     creds,
+		Settings:        c.Config.Providers[prov.Name()].Options,
+		SessionFile:     pw.SessionFile(c.SessionDir, prov.Name(), account),
+		SessionCipher:   c.SessionCipher,
+		Manifest:        c.Manifest.Scope(prov.Name(), account),
+		Filename:        template.Namer(fields),
+		Collision:       c.Collision,
+		Sidecar:         &pw.Sidecar{Provider: prov.Name(), Account: account, Type: fields.Type},
+		DriverDirectory: c.DriverDir,
+		ExpectedPages:   c.Config.Providers[prov.Name()].ExpectedPages,
+		QuarantineDir:   c.QuarantineDir,
+		Artifacts:       pw.Artifacts{Dir: c.ArtifactsDir, Provider: prov.Name(), Account: account, Keep: c.ArtifactsKeep},
+		Trace:           c.Trace,
+		RecordHAR:       c.RecordHAR,
+		Video:           c.Video,
+		VideoMaxSize:    c.VideoMaxSize,
+	}, nil
 }
 
-func (r *FreeboxCmd) Run(ctx *Context) error {
-	fmt.Println("Running Freebox...")
-	return freebox.Run(os.Stdout, os.Stderr, ctx.Headless, r.Username, r.Password, ctx.OutputDir)
+// filenameTemplate returns the template naming the documents of prov, --filename-template taking precedence
+// over the configuration file.
+func (c *Context) filenameTemplate(prov provider.Provider) (naming.Template, error) {
+	if c.FilenameTemplate != "" {
+		return naming.Parse(c.FilenameTemplate)
+	}
+
+	return c.Config.FilenameTemplateFor(prov)
 }
 
-type FreeMobileCmd struct {
-	Username string `required:"" short:"u" help:"Free mobile username"`
-	Password string `required:"" short:"p" help:"Free mobile password"`
+// browsers returns the browsers needed by the providers in the configuration file,
+// or by every registered provider if it lists none.
+func (c *Context) browsers() ([]pw.Browser, error) {
+	provs := providers.Registry.All()
+	if len(c.Config.Providers) > 0 {
+		provs = provs[:0:0]
+
+		for name := range c.Config.Providers {
+			if prov, ok := providers.Registry.Get(name); ok {
+				provs = append(provs, prov)
+			}
+		}
+	}
+
+	var browsers []pw.Browser
+
+	for _, prov := range provs {
+		browser, err := c.Config.BrowserFor(prov)
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(browsers, browser) {
+			browsers = append(browsers, browser)
+		}
+	}
+
+	slices.Sort(browsers)
+
+	return browsers, nil
 }
 
-func (r *FreeMobileCmd) Run(ctx *Context) error {
-	fmt.Println("Running FreeMobile...")
-	return freemobile.Run(os.Stdout, os.Stderr, os.Stdin, ctx.Headless, r.Username, r.Password, ctx.OutputDir, ctx.NoInteraction)
+// ProviderCmd is the command generated for every registered provider.
+type ProviderCmd struct {
+	Account      string `short:"a" help:"Account to use from the configuration file. Defaults to the first one."`
+	Username     string `short:"u" help:"${username_help}."`
+	Password     string `short:"p" help:"${password_help}. Visible to other users in the process list, prefer another source."`
+	PasswordFile string `help:"Read the password from this file." type:"existingfile"`
+	PasswordFD   *int   `help:"Read the password from this file descriptor." name:"password-fd"`
+
+	provider provider.Provider
+}
+
+// Help implements kong.HelpProvider.
+func (r *ProviderCmd) Help() string {
+	return credentials.Precedence
 }
 
-type EauDuGrandLyonCmd struct {
-	Username string `required:"" short:"u" help:"Eau du Grand Lyon username"`
-	Password string `required:"" short:"p" help:"Eau du Grand Lyon password"`
+func (r *ProviderCmd) Run(ctx context.Context, globals *Context) error {
+	account, err := globals.Config.Account(r.provider.Name(), r.Account)
+	if err != nil {
+		return err
+	}
+
+	sources := credentials.Sources{
+		Flags:   map[string]string{"username": r.Username, "password": r.Password},
+		Files:   map[string]string{"password": r.PasswordFile},
+		FDs:     map[string]int{},
+		Lookup:  os.LookupEnv,
+		Config:  account.Credentials,
+		Secrets: globals.Secrets,
+	}
+
+	if r.PasswordFD != nil {
+		sources.FDs["password"] = *r.PasswordFD
+	}
+
+	if !globals.NoInteraction {
+		sources.Prompt = credentials.TerminalPrompter{In: os.Stdin, Out: os.Stderr}
+	}
+
+	creds, err := credentials.Resolve(r.provider, sources)
+	if err != nil {
+		return err
+	}
+
+	if missing := creds.Missing(r.provider.CredentialFields()); len(missing) > 0 {
+		return fmt.Errorf("%w: %s", errMissingCreds, strings.Join(missing, ", "))
+	}
+
+	opts, err := globals.providerOptions(r.provider, account.Name, creds)
+	if err != nil {
+		return err
+	}
+
+	result := runner.Run(ctx, []runner.Job{{Provider: r.provider, Options: opts}})[0]
+
+	if globals.Output == outputJSON {
+		if err := runner.PrintJSON(os.Stdout, []runner.Result{result}); err != nil {
+			return err
+		}
+	} else {
+		for _, doc := range result.Saved {
+			fmt.Println(doc.Path)
+		}
+	}
+
+	return result.Err
 }
 
-func (r *EauDuGrandLyonCmd) Run(ctx *Context) error {
-	fmt.Println("Running EauDuGrandLyon...")
-	return eaudugrandlyon.Run(os.Stdout, os.Stderr, ctx.Headless, r.Username, r.Password, ctx.OutputDir)
+type RunAllCmd struct {
+	Only []string `help:"Only run these providers."`
+	Skip []string `help:"Skip these providers."`
 }
 
-type OctopusEnergyAddressCmd struct {
-	Username string `required:"" short:"u" help:"Octopus Energy username"`
-	Password string `required:"" short:"p" help:"Octopus Energy password"`
+func (r *RunAllCmd) Run(ctx context.Context, globals *Context) error {
+	selected, err := runner.Select(providers.Registry, r.Only, r.Skip)
+	if err != nil {
+		return err
+	}
+
+	var jobs []runner.Job
+
+	for _, prov := range selected {
+		jobs = append(jobs, globals.jobs(prov)...)
+	}
+
+	results := runner.Run(ctx, jobs)
+
+	if globals.Output == outputJSON {
+		if err := runner.PrintJSON(os.Stdout, results); err != nil {
+			return err
+		}
+	} else {
+		runner.PrintSummary(os.Stdout, results)
+	}
+
+	if failed := runner.Failed(results); failed > 0 {
+		return failures{failed: failed, total: len(results), results: results}
+	}
+
+	return nil
 }
 
-func (r *OctopusEnergyAddressCmd) Run(ctx *Context) error {
-	fmt.Println("Running OctopusEnergyAddress...")
-	return octopusenergyaddress.Run(os.Stdout, os.Stderr, ctx.Headless, r.Username, r.Password, ctx.OutputDir)
+// failures is returned by run-all when some providers failed. It wraps their errors,
+// so that the exit code reflects them.
+type failures struct {
+	failed, total int
+	results       []runner.Result
 }
 
-type ShivaCmd struct {
-	Username string `required:"" short:"u" help:"Shiva username"`
-	Password string `required:"" short:"p" help:"Shiva password"`
+func (f failures) Error() string {
+	return fmt.Sprintf("%s: %d out of %d", errProvidersFailed, f.failed, f.total)
 }
 
-func (r *ShivaCmd) Run(ctx *Context) error {
-	fmt.Println("Running Shiva...")
-	return shiva.Run(os.Stdout, os.Stderr, ctx.Headless, r.Username, r.Password, ctx.OutputDir)
+func (f failures) Unwrap() []error {
+	wrapped := []error{errProvidersFailed}
+
+	for _, result := range f.results {
+		if result.Status == runner.StatusFailed {
+			wrapped = append(wrapped, result.Err)
+		}
+	}
+
+	return wrapped
+}
+
+// jobs returns one job per account of prov in the configuration file,
+// or a single job using credentials from the environment if there is none.
+func (c *Context) jobs(prov provider.Provider) []runner.Job {
+	// Providers absent from the configuration file are skipped when the environment lacks credentials,
+	// but incomplete accounts in the file are errors. The environment is only looked up for those providers,
+	// its variables cannot target a specific account.
+	accounts := c.Config.Providers[prov.Name()].Accounts
+	fromEnv := len(accounts) == 0
+
+	if fromEnv {
+		accounts = []config.Account{{}}
+	}
+
+	jobs := make([]runner.Job, 0, len(accounts))
+
+	for _, account := range accounts {
+		job := runner.Job{Provider: prov, Options: provider.Options{Account: account.Name}}
+
+		sources := credentials.Sources{Config: account.Credentials, Secrets: c.Secrets}
+		errMissing := errMissingCreds
+
+		if fromEnv {
+			sources.Lookup = os.LookupEnv
+			errMissing = runner.ErrNotConfigured
+		}
+
+		creds, err := credentials.Resolve(prov, sources)
+		if err != nil {
+			job.Err = err
+		} else if missing := creds.Missing(prov.CredentialFields()); len(missing) > 0 {
+			job.Err = fmt.Errorf("%w: %s", errMissing, strings.Join(missing, ", "))
+		} else {
+			job.Options, job.Err = c.providerOptions(prov, account.Name, creds)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+type ConfigCmd struct {
+	Validate ConfigValidateCmd `cmd:"" help:"Check the configuration file for unknown keys and missing credentials."`
+}
+
+type ConfigValidateCmd struct{}
+
+func (r *ConfigValidateCmd) Run(globals *Context) error {
+	problems := globals.Config.Validate(providers.Registry)
+	if globals.OutputDir == "" {
+		problems = append(problems, errMissingOutputDir)
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d problem(s)", errInvalidConfig, len(problems))
+	}
+
+	fmt.Println("Configuration is valid.")
+
+	return nil
+}
+
+type InstallCmd struct{}
+
+func (r *InstallCmd) Run(globals *Context) error {
+	browsers, err := globals.browsers()
+	if err != nil {
+		return err
+	}
+
+	return pw.Install(pw.InstallOptions{
+		DriverDirectory: globals.DriverDir,
+		Browsers:        browsers,
+		Stdout:          pw.LogWriter(globals.Logger, slog.LevelInfo, "playwright"),
+		Stderr:          pw.LogWriter(globals.Logger, slog.LevelWarn, "playwright"),
+	})
+}
+
+type PruneCmd struct {
+	DryRun bool              `help:"Only report the documents that would be deleted."`
+	Keep   map[string]string `help:"Retention period of a document type, e.g. --keep proof-of-address=6mo. Overrides retention in the configuration file." placeholder:"TYPE=PERIOD"`
+}
+
+// pruned is a document deleted, or to be deleted, by the prune command.
+type pruned struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Date    string `json:"date"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (r *PruneCmd) Run(globals *Context) error {
+	if globals.OutputDir == "" {
+		return errMissingOutputDir
+	}
+
+	rules := maps.Clone(globals.Config.Retention)
+	if rules == nil {
+		rules = make(map[string]string, len(r.Keep))
+	}
+
+	maps.Copy(rules, r.Keep)
+
+	policy, err := retention.ParsePolicy(rules)
+	if err != nil {
+		return err
+	}
+
+	typeOf := func(name string) provider.DocumentType {
+		if prov, ok := providers.Registry.Get(name); ok && len(prov.DocumentTypes()) > 0 {
+			return prov.DocumentTypes()[0]
+		}
+
+		return ""
+	}
+
+	candidates := policy.Expired(globals.Manifest.Entries(), globals.OutputDir, typeOf, time.Now())
+	results := make([]pruned, 0, len(candidates))
+
+	var failed []error
+
+	for _, candidate := range candidates {
+		result := pruned{Path: candidate.Path, Type: string(candidate.Type), Date: candidate.Date.Format(time.DateOnly)}
+
+		if !r.DryRun {
+			if err := retention.Delete(globals.OutputDir, candidate); err != nil {
+				failed = append(failed, err)
+			} else {
+				result.Deleted = true
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	if globals.Output == outputJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(results); err != nil {
+			return fmt.Errorf("writing results: %w", err)
+		}
+	} else {
+		for _, result := range results {
+			action := "would delete"
+
+			switch {
+			case result.Deleted:
+				action = "deleted"
+			case !r.DryRun:
+				action = "failed to delete"
+			}
+
+			_, _ = fmt.Printf("%s %s (%s, %s)\n", action, result.Path, result.Type, result.Date)
+		}
+	}
+
+	return errors.Join(failed...)
 }
 
-type LCLCheckingCmd struct {
-	Username string `required:"" short:"u" help:"LCL username"`
-	Password string `required:"" short:"p" help:"LCL password"`
+type DoctorCmd struct{}
+
+func (r *DoctorCmd) Run(globals *Context) error {
+	browsers, err := globals.browsers()
+	if err != nil {
+		return err
+	}
+
+	checks := pw.Doctor(pw.InstallOptions{
+		DriverDirectory: globals.DriverDir,
+		Browsers:        browsers,
+		Stderr:          io.Discard,
+	})
+
+	if globals.OutputDir == "" {
+		checks = append(checks, pw.Check{Name: "output dir", Err: errMissingOutputDir})
+	} else {
+		checks = append(checks, pw.Check{Name: "output dir", Detail: globals.OutputDir, Err: checkWritable(globals.OutputDir)})
+	}
+
+	checks = append(checks, pw.Check{Name: "session dir", Detail: globals.SessionDir, Err: checkWritable(globals.SessionDir)})
+	checks = append(checks, pw.Check{Name: "quarantine dir", Detail: globals.QuarantineDir, Err: checkWritable(globals.QuarantineDir)})
+	checks = append(checks, pw.Check{Name: "artifacts dir", Detail: globals.ArtifactsDir, Err: checkWritable(globals.ArtifactsDir)})
+
+	problems := 0
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, check := range checks {
+		status := "ok"
+		if check.Err != nil {
+			status = "error"
+			check.Detail = check.Err.Error()
+			problems++
+		}
+
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\n", check.Name, status, check.Detail)
+	}
+
+	_ = writer.Flush()
+
+	if problems > 0 {
+		return fmt.Errorf("%w: %d problem(s), run the install command if the driver or browsers are missing", errDoctor, problems)
+	}
+
+	return nil
 }
 
-func (r *LCLCheckingCmd) Run(ctx *Context) error {
-	fmt.Println("Running LCLChecking...")
-	return lclchecking.Run(os.Stdout, os.Stderr, ctx.Headless, r.Username, r.Password, ctx.OutputDir)
+// checkWritable checks that files can be created in dir, or in its closest existing parent
+// since directories are created when needed.
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if errors.Is(err, os.ErrNotExist) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+
+		break
+	}
+
+	file, err := os.CreateTemp(dir, ".downloader-doctor-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+
+	_ = file.Close()
+
+	return os.Remove(file.Name())
 }
 
 type Cli struct {
-	OutputDir     string `help:"Output directory." required:"" short:"o" type:"path"`
-	Headless      bool   `help:"Enable headless mode."`
-	NoInteraction bool   `help:"Enable interaction-less mode. In this mode, if a user interaction is required, it will generate an error instead."`
+	Config           string         `help:"Configuration file." type:"path" default:"${config_path}"`
+	OutputDir        string         `help:"Output directory." short:"o" type:"path"`
+	SessionDir       string         `help:"Directory holding browser sessions, one file per provider and account. Defaults to ${session_dir}." type:"path"`
+	Manifest         string         `help:"File recording the documents already saved, so that they are only downloaded once. Defaults to ${manifest_path}." type:"path"`
+	FilenameTemplate string         `help:"Template naming saved documents, e.g. {provider}/{year}/{date:2006-01}-{type}-{account}.{ext}. Defaults to ${filename_template} or a provider-specific one."`
+	Layout           string         `help:"Directory structure of saved documents: flat (default) or structured, in provider/account/year directories."`
+	OnCollision      string         `help:"What to do when a file already exists under the name of a document: skip, overwrite, suffix or compare-hash (default), which keeps identical files and suffixes others."`
+	SessionKeyFile   string         `help:"age key file encrypting session files. A passphrase can be set in the ${session_passphrase_env} environment variable instead." type:"existingfile"`
+	Output           string         `help:"Format of the results written to stdout: text or json. Progress is written to stderr." enum:"text,json" default:"text"`
+	Trace            *bool          `negatable:"" help:"Record a playwright trace of each run, added to the failure bundle when it fails. Traces hold the typed passwords."`
+	RecordHAR        *bool          `name:"record-har" negatable:"" help:"Save the network exchanges of each run as a HAR in its bundle, scrubbed of request bodies, credential headers, cookies, URL queries, tokens and credentials."`
+	LogLevel         string         `help:"Minimum level of the logs written to stderr: debug, info, warn or error." enum:"debug,info,warn,error" default:"info"`
+	LogFormat        string         `help:"Format of the logs written to stderr: text or json." enum:"text,json" default:"text"`
+	RecordVideo      string         `help:"Record a video of each run, kept in its bundle: never (default), on-failure or always."`
+	VideoMaxSize     int64          `help:"Size in MiB over which videos are discarded, ${video_max_size} by default. Negative values keep every video."`
+	Headless         *bool          `negatable:"" help:"Enable headless mode."`
+	NoInteraction    *bool          `negatable:"interaction" help:"Enable interaction-less mode. In this mode, if a user interaction is required, it will generate an error instead."`
+	All              bool           `help:"Backfill mode: download every document listed by the providers instead of only the latest one, skipping those already saved."`
+	Since            time.Time      `help:"Only download documents dated on or after this day, e.g. 2024-01-31." format:"2006-01-02" xor:"since"`
+	Until            time.Time      `help:"Only download documents dated on or before this day, e.g. 2024-12-31." format:"2006-01-02" xor:"until"`
+	Month            time.Time      `help:"Only download documents dated in this month, e.g. 2024-03." format:"2006-01" xor:"since,until"`
+	Timeout          *time.Duration `placeholder:"DURATION" help:"Abort the run after this duration, e.g. 10m, 0 for no timeout. Applies to all providers of run-all together."`
+	DriverDir        string         `help:"Directory holding the playwright driver. Defaults to the playwright-go cache directory, or PLAYWRIGHT_DRIVER_PATH." type:"path"`
+	QuarantineDir    string         `help:"Directory keeping the downloads that are not valid PDF documents, e.g. error pages. Defaults to ${quarantine_dir}." type:"path"`
+	ArtifactsDir     string         `help:"Directory holding a bundle per failed run, with a screenshot, the page HTML and URL, the error and console messages. Defaults to ${artifacts_dir}." type:"path"`
+	ArtifactsKeep    int            `help:"Number of failure bundles kept per provider and account, ${artifacts_keep} by default. Negative values keep every bundle."`
+
+	RunAll    RunAllCmd  `cmd:"" help:"Download documents from every configured provider. Credentials are read from the configuration file, or from DOWNLOADER_<PROVIDER>_<FIELD> environment variables, e.g. DOWNLOADER_FREE_MOBILE_PASSWORD."`
+	ConfigCmd ConfigCmd  `cmd:"" name:"config" help:"Manage the configuration file."`
+	Install   InstallCmd `cmd:"" help:"Download the playwright driver and the browsers needed by the configured providers."`
+	Doctor    DoctorCmd  `cmd:"" help:"Check the playwright driver, browsers, output and session directories without downloading anything."`
+	Prune     PruneCmd   `cmd:"" help:"Delete saved documents older than the retention period of their type. Only documents recorded in the manifest are deleted."`
+}
 
-	Freebox              FreeboxCmd              `cmd:"" help:"Download latest invoice from Freebox."`
-	FreeMobile           FreeMobileCmd           `cmd:"" help:"Download latest invoice from Free mobile."`
-	EauDuGrandLyon       EauDuGrandLyonCmd       `cmd:"" help:"Download latest invoice from Eau du Grand Lyon."`
-	OctopusEnergyAddress OctopusEnergyAddressCmd `cmd:"" help:"Download latest proof of address from Octopus Energy."`
-	Shiva                ShivaCmd                `cmd:"" help:"Download latest payslip from Shiva."`
-	LCLChecking          LCLCheckingCmd          `cmd:"" help:"Download latest bank statement from LCL."`
+// period returns the period selected by the --since, --until and --month flags.
+func (c *Cli) period() (provider.Period, error) {
+	if !c.Month.IsZero() {
+		return provider.MonthPeriod(c.Month), nil
+	}
+
+	if !c.Since.IsZero() && !c.Until.IsZero() && c.Until.Before(c.Since) {
+		return provider.Period{}, fmt.Errorf("%w: --until is before --since", errInvalidPeriod)
+	}
+
+	return provider.Period{Since: c.Since, Until: c.Until}, nil
+}
+
+// flagOr returns the value of a flag when it was set, so that flags override the configuration file, or value.
+func flagOr[T any](flag *T, value T) T {
+	if flag != nil {
+		return *flag
+	}
+
+	return value
+}
+
+// loadConfig loads the configuration file at path.
+// A missing file is only an error if it is not the default one.
+func loadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if errors.Is(err, os.ErrNotExist) && path == config.DefaultPath() {
+		return &config.Config{}, nil
+	}
+
+	return cfg, err
+}
+
+// sessionCipher returns the cipher encrypting session files, or nil when no key is configured.
+// The key file flag takes precedence over the passphrase environment variable, then the configuration file.
+func sessionCipher(keyFile string, key config.SessionKey, resolver *secrets.Resolver) (*pw.SessionCipher, error) {
+	if keyFile != "" {
+		return pw.KeyFileCipher(keyFile)
+	}
+
+	if passphrase := os.Getenv(sessionPassphraseEnv); passphrase != "" {
+		return pw.PassphraseCipher(passphrase)
+	}
+
+	if key.Passphrase != "" {
+		passphrase, err := resolver.Resolve(key.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("resolving session passphrase: %w", err)
+		}
+
+		return pw.PassphraseCipher(passphrase)
+	}
+
+	if key.File != "" {
+		return pw.KeyFileCipher(key.File)
+	}
+
+	return nil, nil //nolint:nilnil // no encryption
+}
+
+// providerCommands builds one kong command per registered provider.
+func providerCommands(reg *provider.Registry) []kong.Option {
+	options := make([]kong.Option, 0, len(reg.All()))
+
+	for _, prov := range reg.All() {
+		tags := make([]string, 0, len(prov.CredentialFields()))
+		for _, field := range prov.CredentialFields() {
+			tags = append(tags, fmt.Sprintf("set:%q", field.Name+"_help="+field.Help))
+		}
+
+		cmd := &ProviderCmd{provider: prov}
+		options = append(options, kong.DynamicCommand(prov.Name(), prov.Description(), "", cmd, tags...))
+	}
+
+	return options
 }
 
 func main() {
 	var cli Cli
-	ctx := kong.Parse(&cli)
-	err := ctx.Run(&Context{OutputDir: cli.OutputDir, Headless: cli.Headless, NoInteraction: cli.NoInteraction})
-	ctx.FatalIfErrorf(err)
+
+	options := append(providerCommands(providers.Registry), kong.Vars{
+		"config_path":            config.DefaultPath(),
+		"session_dir":            pw.DefaultSessionDir(),
+		"manifest_path":          manifest.DefaultPath(),
+		"quarantine_dir":         pw.DefaultQuarantineDir(),
+		"artifacts_dir":          pw.DefaultArtifactsDir(),
+		"artifacts_keep":         strconv.Itoa(defaultArtifactsKeep),
+		"video_max_size":         strconv.Itoa(defaultVideoMaxSize),
+		"filename_template":      naming.Default,
+		"session_passphrase_env": sessionPassphraseEnv,
+	})
+	kctx := kong.Parse(&cli, options...)
+
+	logger, err := newLogger(os.Stderr, cli.LogLevel, cli.LogFormat)
+	kctx.FatalIfErrorf(err)
+
+	cfg, err := loadConfig(cli.Config)
+	kctx.FatalIfErrorf(err)
+
+	resolver := secrets.Default(cfg.Secrets)
+
+	cipher, err := sessionCipher(cli.SessionKeyFile, cfg.SessionKey, resolver)
+	kctx.FatalIfErrorf(err)
+
+	period, err := cli.period()
+	kctx.FatalIfErrorf(err)
+
+	var (
+		collision pw.Collision
+		video     pw.Video
+		layout    naming.Layout
+	)
+
+	// config validate reports invalid values along with every other problem of the file, instead of the first one.
+	if kctx.Command() != "config validate" {
+		collision, err = pw.ParseCollision(cmp.Or(cli.OnCollision, cfg.OnCollision, string(pw.CollisionCompareHash)))
+		kctx.FatalIfErrorf(err)
+
+		video, err = pw.ParseVideo(cmp.Or(cli.RecordVideo, cfg.RecordVideo, string(pw.VideoNever)))
+		kctx.FatalIfErrorf(err)
+
+		layout, err = naming.ParseLayout(cmp.Or(cli.Layout, cfg.Layout, string(naming.LayoutFlat)))
+		kctx.FatalIfErrorf(err)
+	}
+
+	saved, err := manifest.Load(cmp.Or(cli.Manifest, cfg.Manifest, manifest.DefaultPath()))
+	kctx.FatalIfErrorf(err)
+
+	ctx, cancel := signalContext(flagOr(cli.Timeout, cfg.Timeout))
+	defer cancel()
+
+	kctx.BindTo(ctx, (*context.Context)(nil))
+
+	err = kctx.Run(&Context{
+		OutputDir:        cmp.Or(cli.OutputDir, cfg.OutputDir),
+		SessionDir:       cmp.Or(cli.SessionDir, cfg.SessionDir, pw.DefaultSessionDir()),
+		SessionCipher:    cipher,
+		DriverDir:        cmp.Or(cli.DriverDir, cfg.DriverDir),
+		QuarantineDir:    cmp.Or(cli.QuarantineDir, cfg.QuarantineDir, pw.DefaultQuarantineDir()),
+		ArtifactsDir:     cmp.Or(cli.ArtifactsDir, cfg.ArtifactsDir, pw.DefaultArtifactsDir()),
+		ArtifactsKeep:    cmp.Or(cli.ArtifactsKeep, cfg.ArtifactsKeep, defaultArtifactsKeep),
+		Trace:            flagOr(cli.Trace, cfg.Trace),
+		RecordHAR:        flagOr(cli.RecordHAR, cfg.RecordHAR),
+		Logger:           logger,
+		Video:            video,
+		VideoMaxSize:     cmp.Or(cli.VideoMaxSize, cfg.VideoMaxSize, defaultVideoMaxSize) << 20,
+		Headless:         flagOr(cli.Headless, cfg.Headless),
+		NoInteraction:    flagOr(cli.NoInteraction, cfg.NoInteraction),
+		All:              cli.All,
+		Period:           period,
+		Manifest:         saved,
+		FilenameTemplate: cli.FilenameTemplate,
+		Layout:           layout,
+		Collision:        collision,
+		Output:           cli.Output,
+		Config:           cfg,
+		Secrets:          resolver,
+	})
+	if err != nil {
+		kctx.Errorf("%s", err)
+		kctx.Exit(errs.ExitCode(err))
+	}
+}
+
+// newLogger returns a logger writing records of level and above to w, formatted as text or json.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("parsing log level: %w", err)
+	}
+
+	options := &slog.HandlerOptions{Level: minLevel}
+
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+
+	return slog.New(slog.NewTextHandler(w, options)), nil
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM, or after timeout if not zero.
+// A second signal kills the process right away.
+func signalContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	cancel := stop
+
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+
+	return ctx, cancel
 }